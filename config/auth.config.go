@@ -0,0 +1,18 @@
+package config
+
+import "os"
+
+// AuthConfig holds the authentication settings of the API
+type AuthConfig struct {
+	// Required rejects requests without an API key, except signed URLs and
+	// direct uploads which carry their own signature. On unless AUTH_REQUIRED
+	// is "false".
+	Required bool
+}
+
+// LoadAuthConfig initializes authentication configuration from environment variables
+func LoadAuthConfig() AuthConfig {
+	return AuthConfig{
+		Required: os.Getenv("AUTH_REQUIRED") != "false",
+	}
+}
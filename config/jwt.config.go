@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// JWTConfig holds the settings for bearer tokens issued by other services.
+// Tokens are only accepted when at least one key source is set.
+type JWTConfig struct {
+	Secret        string // HS256 shared secret
+	PublicKeyFile string // PEM encoded RSA (RS256) or P-256 (ES256) public key
+	JWKSFile      string // JSON Web Key Set, keys are matched by "kid"
+	Issuer        string // required "iss" when set
+	Audience      string // required in "aud" when set
+	Leeway        time.Duration
+	TenantClaim   string
+	ScopesClaim   string // space separated string or array of scopes
+	GroupsClaim   string // array of the groups ACL entries can grant permissions to
+}
+
+// LoadJWTConfig initializes JWT configuration from environment variables
+func LoadJWTConfig() JWTConfig {
+	return JWTConfig{
+		Secret:        os.Getenv("JWT_HS256_SECRET"),
+		PublicKeyFile: os.Getenv("JWT_PUBLIC_KEY_FILE"),
+		JWKSFile:      os.Getenv("JWT_JWKS_FILE"),
+		Issuer:        os.Getenv("JWT_ISSUER"),
+		Audience:      os.Getenv("JWT_AUDIENCE"),
+		Leeway:        getEnvDuration("JWT_LEEWAY", 30*time.Second),
+		TenantClaim:   getEnv("JWT_TENANT_CLAIM", "tenant"),
+		ScopesClaim:   getEnv("JWT_SCOPES_CLAIM", "scopes"),
+		GroupsClaim:   getEnv("JWT_GROUPS_CLAIM", "groups"),
+	}
+}
+
+// Enabled reports whether a key to verify tokens with is configured
+func (c JWTConfig) Enabled() bool {
+	return c.Secret != "" || c.PublicKeyFile != "" || c.JWKSFile != ""
+}
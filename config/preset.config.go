@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ImagePreset describes a derivative rendered from every image uploaded
+// through a policy listing it
+type ImagePreset struct {
+	Name    string `json:"-"`
+	Width   int    `json:"width"` // 0 keeps the aspect ratio from Height
+	Height  int    `json:"height"`
+	Fit     string `json:"fit"`    // "contain" (default) or "cover"
+	Format  string `json:"format"` // "jpeg", "png" or "gif", empty for the format of the source
+	Quality int    `json:"quality"`
+}
+
+// defaultImagePresets are available even when no preset file is configured
+var defaultImagePresets = map[string]ImagePreset{
+	"thumbnail": {Width: 150, Height: 150, Fit: "cover", Format: "jpeg", Quality: 80},
+	"card":      {Width: 400, Height: 400, Fit: "contain"},
+	"zoom":      {Width: 1600, Height: 1600, Fit: "contain"},
+}
+
+// LoadImagePresets returns the built-in image presets merged with the ones
+// defined in the JSON file named by IMAGE_PRESETS_FILE, keyed by name
+func LoadImagePresets() (map[string]ImagePreset, error) {
+	presets := map[string]ImagePreset{}
+	for name, preset := range defaultImagePresets {
+		preset.Name = name
+		presets[name] = preset
+	}
+
+	path := os.Getenv("IMAGE_PRESETS_FILE")
+	if path == "" {
+		return presets, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading image presets: %w", err)
+	}
+	var configured map[string]ImagePreset
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return nil, fmt.Errorf("parsing image presets: %w", err)
+	}
+	for name, preset := range configured {
+		preset.Name = name
+		presets[name] = preset
+	}
+	return presets, nil
+}
+
+// PresetsAsync reports whether presets are rendered in the background
+// instead of before the upload response is sent
+func PresetsAsync() bool {
+	return os.Getenv("IMAGE_PRESETS_ASYNC") == "true"
+}
@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// PublicConfig holds the settings for files delivered without credentials
+type PublicConfig struct {
+	DefaultVisibility string        // visibility of uploads that do not pick one
+	MaxAge            time.Duration // Cache-Control max-age of public files
+}
+
+// LoadPublicConfig initializes public delivery configuration from environment variables
+func LoadPublicConfig() PublicConfig {
+	return PublicConfig{
+		DefaultVisibility: getEnv("FILE_DEFAULT_VISIBILITY", "private"),
+		MaxAge:            getEnvDuration("PUBLIC_CACHE_MAX_AGE", time.Hour),
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// SigningConfig holds the settings for HMAC signed URLs
+type SigningConfig struct {
+	Secret     string
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+	// Required makes FileController.Read reject requests without a valid signature
+	Required bool
+}
+
+// LoadSigningConfig initializes URL signing configuration from environment variables
+func LoadSigningConfig() SigningConfig {
+	return SigningConfig{
+		Secret:     os.Getenv("URL_SIGNING_SECRET"),
+		DefaultTTL: getEnvDuration("URL_SIGNING_TTL", 15*time.Minute),
+		MaxTTL:     getEnvDuration("URL_SIGNING_MAX_TTL", 7*24*time.Hour),
+		Required:   os.Getenv("URL_SIGNING_REQUIRED") == "true",
+	}
+}
+
+// getEnvDuration parses a duration such as "15m", using fallback when unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"my-project/storage"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StaticRoot is the directory served as is under /public/static
+const StaticRoot = "public/static"
+
+// legacyLocalRoot is where the local disk used to keep its objects, inside
+// the web root, and legacyPrefixes the key prefixes it wrote there
+const legacyLocalRoot = "public"
+
+var legacyPrefixes = []string{"uploads", "staging", "blobs", "derivatives", "tenants"}
+
+// StorageConfig holds the storage backend settings
+type StorageConfig struct {
+	Driver      string
+	LocalRoot   string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+	S3Prefix    string
+}
+
+// LoadStorageConfig initializes storage configuration from environment variables
+func LoadStorageConfig() StorageConfig {
+	return StorageConfig{
+		Driver:      getEnv("STORAGE_DRIVER", "local"),
+		LocalRoot:   getEnv("STORAGE_LOCAL_ROOT", "storage"),
+		S3Endpoint:  os.Getenv("S3_ENDPOINT"),
+		S3Region:    os.Getenv("S3_REGION"),
+		S3Bucket:    os.Getenv("S3_BUCKET"),
+		S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+		S3PathStyle: getEnv("S3_PATH_STYLE", "true") == "true",
+		S3Prefix:    os.Getenv("S3_PREFIX"),
+	}
+}
+
+// ConnectStorage registers every configured disk and selects the default one.
+// The local disk is always registered so records stored there stay readable
+// after switching the default driver to s3.
+func ConnectStorage() error {
+	config := LoadStorageConfig()
+	if within(config.LocalRoot, StaticRoot) {
+		return fmt.Errorf("local storage: %s is inside the static web root %s", config.LocalRoot, StaticRoot)
+	}
+	if os.Getenv("STORAGE_LOCAL_ROOT") == "" {
+		if err := moveLegacyUploads(config.LocalRoot); err != nil {
+			return fmt.Errorf("local storage: %w", err)
+		}
+	}
+
+	local, err := storage.NewLocal(config.LocalRoot)
+	if err != nil {
+		return fmt.Errorf("local storage: %w", err)
+	}
+	storage.Register("local", local)
+
+	if config.S3Bucket != "" {
+		s3, err := storage.NewS3(storage.S3Options{
+			Endpoint:  config.S3Endpoint,
+			Region:    config.S3Region,
+			Bucket:    config.S3Bucket,
+			AccessKey: config.S3AccessKey,
+			SecretKey: config.S3SecretKey,
+			PathStyle: config.S3PathStyle,
+			Prefix:    config.S3Prefix,
+		})
+		if err != nil {
+			return fmt.Errorf("s3 storage: %w", err)
+		}
+		storage.Register("s3", s3)
+	}
+
+	storage.SetDefault(config.Driver)
+	if _, err := storage.Default(); err != nil {
+		return fmt.Errorf("unsupported storage driver: %s", config.Driver)
+	}
+	return nil
+}
+
+// within reports whether dir is root or a directory below it
+func within(dir, root string) bool {
+	dirAbs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(rootAbs, dirAbs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// moveLegacyUploads moves the objects the local disk stored under ./public,
+// where the static route exposed them, to root. Prefixes root already has are
+// left alone.
+func moveLegacyUploads(root string) error {
+	for _, prefix := range legacyPrefixes {
+		source := filepath.Join(legacyLocalRoot, prefix)
+		if _, err := os.Stat(source); os.IsNotExist(err) {
+			continue
+		}
+		target := filepath.Join(root, prefix)
+		if _, err := os.Stat(target); err == nil {
+			log.Printf("⚠️ Both %s and %s exist, leaving %s in place", source, target, source)
+			continue
+		}
+		if err := os.MkdirAll(root, os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(source, target); err != nil {
+			return err
+		}
+		log.Printf("Moved %s out of the web root to %s", source, target)
+	}
+	return nil
+}
+
+// getEnv returns the environment variable or a fallback when it is unset
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,22 @@
+package config
+
+import "os"
+
+// TransformConfig holds the limits of on-the-fly image transformations
+type TransformConfig struct {
+	MaxDimension   int   // largest width or height that can be requested
+	MaxPixels      int64 // largest source image, in pixels, that will be decoded
+	DefaultQuality int   // JPEG quality used when none is requested
+	// RequireSignature rejects transform requests without a signed URL
+	RequireSignature bool
+}
+
+// LoadTransformConfig initializes image transformation configuration from environment variables
+func LoadTransformConfig() TransformConfig {
+	return TransformConfig{
+		MaxDimension:     int(getEnvInt64("TRANSFORM_MAX_DIMENSION", 4096)),
+		MaxPixels:        getEnvInt64("TRANSFORM_MAX_PIXELS", 50_000_000),
+		DefaultQuality:   int(getEnvInt64("TRANSFORM_DEFAULT_QUALITY", 85)),
+		RequireSignature: os.Getenv("TRANSFORM_SIGNING_REQUIRED") != "false",
+	}
+}
@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// TrashConfig holds the retention settings of soft deleted files
+type TrashConfig struct {
+	Retention     time.Duration // how long deleted files stay restorable, 0 keeps them forever
+	SweepInterval time.Duration
+}
+
+// LoadTrashConfig initializes trash configuration from environment variables
+func LoadTrashConfig() TrashConfig {
+	return TrashConfig{
+		Retention:     getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		SweepInterval: getEnvDuration("TRASH_SWEEP_INTERVAL", time.Hour),
+	}
+}
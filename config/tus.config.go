@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// TusConfig holds the settings for resumable tus uploads
+type TusConfig struct {
+	UploadDir  string        // local directory holding partially received uploads
+	MaxSize    int64         // largest Upload-Length accepted, in bytes
+	Expiration time.Duration // how long an upload may sit idle before it is deleted, 0 keeps it forever
+}
+
+// LoadTusConfig initializes tus configuration from environment variables
+func LoadTusConfig() TusConfig {
+	return TusConfig{
+		UploadDir:  getEnv("TUS_UPLOAD_DIR", filepath.Join(os.TempDir(), "file-service-tus")),
+		MaxSize:    getEnvInt64("TUS_MAX_SIZE", 10*1024*1024*1024),
+		Expiration: getEnvDuration("TUS_EXPIRATION", 24*time.Hour),
+	}
+}
+
+// getEnvInt64 parses an integer environment variable, using fallback when unset or invalid
+func getEnvInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
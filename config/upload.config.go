@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// UploadPolicy holds the validation rules attached to an upload route
+type UploadPolicy struct {
+	Name         string   `json:"-"`
+	AllowedTypes []string `json:"allowed_types"` // mime patterns such as "image/*", empty for any
+	MinSize      int64    `json:"min_size"`
+	MaxSize      int64    `json:"max_size"`
+	MaxFiles     int      `json:"max_files"` // file parts accepted per request, 0 for unlimited
+	MinWidth     int      `json:"min_width"` // image dimension bounds in pixels, 0 to skip
+	MaxWidth     int      `json:"max_width"`
+	MinHeight    int      `json:"min_height"`
+	MaxHeight    int      `json:"max_height"`
+	Presets      []string `json:"presets"` // image presets rendered after upload
+	// StripMetadata auto-orients JPEG photos and removes EXIF, GPS and text
+	// metadata from JPEG and PNG images, keeping ExifFields as file metadata.
+	// Such images are cleaned in memory, so only image policies enable it.
+	StripMetadata bool     `json:"strip_metadata"`
+	ExifFields    []string `json:"exif_fields"` // "camera" and "taken_at"
+}
+
+// defaultUploadPolicies are available even when no policy file is configured
+var defaultUploadPolicies = map[string]UploadPolicy{
+	"default": {
+		MaxSize:  512 * 1024 * 1024,
+		MaxFiles: 1,
+	},
+	"image": {
+		AllowedTypes:  []string{"image/jpeg", "image/png", "image/gif"},
+		MaxSize:       20 * 1024 * 1024,
+		MaxFiles:      1,
+		StripMetadata: true,
+	},
+	"product-images": {
+		AllowedTypes:  []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+		MaxSize:       20 * 1024 * 1024,
+		MaxFiles:      20,
+		MinWidth:      100,
+		MinHeight:     100,
+		MaxWidth:      10000,
+		MaxHeight:     10000,
+		Presets:       []string{"thumbnail", "card", "zoom"},
+		StripMetadata: true,
+	},
+}
+
+// LoadStripMaxSize returns the largest JPEG or PNG, in bytes, that policies
+// stripping metadata accept, since such images are cleaned in memory
+func LoadStripMaxSize() int64 {
+	return getEnvInt64("STRIP_METADATA_MAX_SIZE", 50*1024*1024)
+}
+
+// LoadUploadPolicies returns the built-in upload policies merged with the
+// ones defined in the JSON file named by UPLOAD_POLICIES_FILE, keyed by name
+func LoadUploadPolicies() (map[string]UploadPolicy, error) {
+	policies := map[string]UploadPolicy{}
+	for name, policy := range defaultUploadPolicies {
+		policy.Name = name
+		policies[name] = policy
+	}
+
+	path := os.Getenv("UPLOAD_POLICIES_FILE")
+	if path == "" {
+		return policies, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading upload policies: %w", err)
+	}
+	var configured map[string]UploadPolicy
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return nil, fmt.Errorf("parsing upload policies: %w", err)
+	}
+	for name, policy := range configured {
+		policy.Name = name
+		policies[name] = policy
+	}
+	return policies, nil
+}
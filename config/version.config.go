@@ -0,0 +1,13 @@
+package config
+
+// VersionConfig holds the retention settings of file versions
+type VersionConfig struct {
+	MaxVersions int // previous versions kept per file, 0 keeps all of them
+}
+
+// LoadVersionConfig initializes versioning configuration from environment variables
+func LoadVersionConfig() VersionConfig {
+	return VersionConfig{
+		MaxVersions: int(getEnvInt64("FILE_MAX_VERSIONS", 10)),
+	}
+}
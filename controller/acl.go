@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"my-project/exceptions"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// aclRequest is the body replacing the grants of a file or folder
+type aclRequest struct {
+	Owner  *string         `json:"owner"` // transfers the resource when set
+	Grants []service.Grant `json:"grants" binding:"required"`
+}
+
+// Permissions handles the GET request describing the owner, the grants and
+// the inherited grants of a file
+func (fc *FileController) Permissions(c *gin.Context) {
+	filename := c.Param("filename")
+	if !authorizeFile(c, middleware.GetTenant(c), filename, service.PermRead, false) {
+		return
+	}
+	acl, err := service.FileACL(middleware.GetTenant(c), filename)
+	if err != nil {
+		aclError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"acl": acl})
+}
+
+// UpdatePermissions handles the PUT request replacing the grants of a file,
+// which requires the share permission
+func (fc *FileController) UpdatePermissions(c *gin.Context) {
+	var request aclRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	acl, err := service.UpdateFileACL(middleware.GetPrincipal(c), middleware.GetTenant(c), c.Param("filename"),
+		service.ACLUpdate{Owner: request.Owner, Grants: request.Grants})
+	if err != nil {
+		aclError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"acl": acl})
+}
+
+// Permissions handles the GET request describing the owner, the grants and
+// the inherited grants of a folder
+func (fc *FolderController) Permissions(c *gin.Context) {
+	id, ok := folderParam(c)
+	if !ok || !authorizeFolder(c, &id, service.PermRead) {
+		return
+	}
+	acl, err := service.FolderACL(middleware.GetTenant(c), id)
+	if err != nil {
+		aclError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"acl": acl})
+}
+
+// UpdatePermissions handles the PUT request replacing the grants of a folder,
+// which requires the share permission. They apply to everything below it.
+func (fc *FolderController) UpdatePermissions(c *gin.Context) {
+	id, ok := folderParam(c)
+	if !ok {
+		return
+	}
+	var request aclRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	acl, err := service.UpdateFolderACL(middleware.GetPrincipal(c), middleware.GetTenant(c), id,
+		service.ACLUpdate{Owner: request.Owner, Grants: request.Grants})
+	if err != nil {
+		aclError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"acl": acl})
+}
+
+// authorizeFile answers 403 unless the caller holds perm on a file of tenant.
+// Unknown files pass so the handler reports them in its own way.
+func authorizeFile(c *gin.Context, tenant, filename, perm string, trashed bool) bool {
+	err := service.AuthorizeFile(middleware.GetPrincipal(c), tenant, filename, perm, trashed)
+	if errors.Is(err, service.ErrFileNotFound) {
+		return true
+	}
+	return permissionGranted(c, err, perm, "file")
+}
+
+// authorizeFolder answers 403 unless the caller holds perm on a folder, nil
+// for the root. Unknown folders pass so the handler reports them.
+func authorizeFolder(c *gin.Context, id *uint, perm string) bool {
+	err := service.AuthorizeFolder(middleware.GetPrincipal(c), middleware.GetTenant(c), id, perm)
+	if errors.Is(err, service.ErrFolderNotFound) {
+		return true
+	}
+	return permissionGranted(c, err, perm, "folder")
+}
+
+// permissionGranted answers a failed permission check
+func permissionGranted(c *gin.Context, err error, perm, resource string) bool {
+	if errors.Is(err, service.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Missing the " + perm + " permission on this " + resource})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// aclError answers a failed permission lookup or update
+func aclError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	case errors.Is(err, service.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Changing permissions requires the share permission, transferring ownership requires owning the resource"})
+	case errors.Is(err, service.ErrInvalidACL):
+		exception := exceptions.NewUnprocessableEntityException("Invalid permissions", []string{err.Error()})
+		c.JSON(exception.StatusCode, exception)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// uploadFolder resolves the folder an upload names by id or path, once the
+// caller may write to it
+func uploadFolder(c *gin.Context, folderID *uint, folderPath string) (string, error) {
+	folder, err := service.UploadFolder(middleware.GetTenant(c), folderID, folderPath)
+	if err != nil {
+		return "", err
+	}
+	return folder, service.AuthorizeFolderPath(middleware.GetPrincipal(c), middleware.GetTenant(c), folder, service.PermWrite)
+}
+
+// parseFolderID reads the "folder_id" field of a form, nil when it is empty
+func parseFolderID(value string) (*uint, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: folder_id %q", service.ErrInvalidFolder, value)
+	}
+	folderID := uint(id)
+	return &folderID, nil
+}
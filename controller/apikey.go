@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"errors"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyController manages the keys used to authenticate against the API
+type APIKeyController struct{}
+
+// Create handles the POST request minting a new key. The full key is only
+// part of this response.
+func (kc *APIKeyController) Create(c *gin.Context) {
+	var request struct {
+		Name      string   `json:"name" binding:"required"`
+		Scopes    []string `json:"scopes" binding:"required"`
+		ExpiresIn int64    `json:"expires_in"` // seconds, 0 for a key that does not expire
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	key, token, err := service.CreateAPIKey(middleware.GetTenant(c), request.Name, request.Scopes, time.Duration(request.ExpiresIn)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := service.APIKeyResponse(key)
+	response["key"] = token
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": response,
+	})
+}
+
+// List handles the GET request listing every key
+func (kc *APIKeyController) List(c *gin.Context) {
+	keys, err := service.ListAPIKeys(middleware.GetTenant(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+
+	response := make([]map[string]interface{}, 0, len(keys))
+	for i := range keys {
+		response = append(response, service.APIKeyResponse(&keys[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": response,
+	})
+}
+
+// Revoke handles the DELETE request disabling a key
+func (kc *APIKeyController) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key id"})
+		return
+	}
+
+	key, err := service.RevokeAPIKey(middleware.GetTenant(c), uint(id))
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_key": service.APIKeyResponse(key),
+	})
+}
@@ -1,17 +1,23 @@
 package controller
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"io"
+	"my-project/config"
+	"my-project/middleware"
 	"my-project/service"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
 )
 
 type FileController struct{}
@@ -19,26 +25,181 @@ type FileController struct{}
 // Read handles the GET request for reading a file
 func (fc *FileController) Read(c *gin.Context) {
 	filename := c.Param("filename")
-	download := c.DefaultQuery("download", "false") == "true"
 
-	if err := service.ReadFile(filename, download, c); err != nil {
+	// Image transformations such as ?w=300&h=200&fit=cover are served from
+	// the derivative cache and must be signed unless configured otherwise
+	transform, err := service.ParseTransform(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenant, download, ok := authorizeRead(c, filename, 0, transform != nil && config.LoadTransformConfig().RequireSignature)
+	if !ok {
+		return
+	}
+
+	if transform != nil {
+		readTransformed(c, tenant, filename, transform, download)
+		return
+	}
+	err = service.ReadFile(tenant, filename, download, c)
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 }
 
+// readTransformed serves a transformed variant of an image
+func readTransformed(c *gin.Context, tenant, filename string, transform *service.Transform, download bool) {
+	err := service.ReadTransformed(tenant, filename, transform, download, c)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	case errors.Is(err, service.ErrNotTransformable):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTransform), errors.Is(err, service.ErrImageTooLarge), errors.Is(err, service.ErrImageUnreadable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
 
-// Upload handles the POST request for uploading a file
-func (fc *FileController) Upload(c *gin.Context) {
-	file, err := c.FormFile("file")
+// authorizeRead verifies signed URLs, and requires one when signing is
+// enforced or required is set. A signed URL only opens the version it was
+// signed for, 0 being the current content. Without a signature the caller
+// must hold the read permission on the file. It reports the tenant the file
+// is looked up in, the one of the signed URL or else of the caller, and
+// whether the file should be sent as an attachment.
+func authorizeRead(c *gin.Context, filename string, version int, required bool) (tenant string, download bool, ok bool) {
+	download = c.DefaultQuery("download", "false") == "true"
+	if c.Query("signature") == "" && !required && !config.LoadSigningConfig().Required {
+		tenant = middleware.GetTenant(c)
+		return tenant, download, authorizeFile(c, tenant, filename, service.PermRead, false)
+	}
+
+	grant, err := service.VerifyDownload(filename, c.Request.URL.Query(), c.ClientIP())
+	if err == nil && grant.Version != version {
+		err = service.ErrInvalidSignature
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File not provided"})
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return "", false, false
+	}
+	if grant.Disposition != "" {
+		download = grant.Disposition == "attachment"
+	}
+	return grant.Tenant, download, true
+}
+
+// Sign handles the POST request issuing a time limited download URL for a file
+func (fc *FileController) Sign(c *gin.Context) {
+	var request struct {
+		ExpiresIn   int64                  `json:"expires_in"` // seconds, defaults to URL_SIGNING_TTL
+		Disposition string                 `json:"disposition"`
+		BindIP      bool                   `json:"bind_ip"`
+		Version     int                    `json:"version"`   // a previous version to share instead of the current content
+		Transform   map[string]interface{} `json:"transform"` // w, h, fit, crop, format and quality of an image variant
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	// Use the service to save file and metadata
-	result, err := service.UploadFile(file)
+	ip := ""
+	if request.BindIP {
+		ip = c.ClientIP()
+	}
+
+	params := url.Values{}
+	for key, value := range request.Transform {
+		params.Set(key, fmt.Sprint(value))
+	}
+	transform, err := service.ParseTransform(params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := c.Param("filename")
+	if !authorizeFile(c, middleware.GetTenant(c), filename, service.PermShare, false) {
+		return
+	}
+	if request.Version < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+		return
+	}
+	query, grant, err := service.SignDownload(middleware.GetTenant(c), filename, request.Version, time.Duration(request.ExpiresIn)*time.Second, request.Disposition, ip, transform)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if errors.Is(err, service.ErrVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	path := strings.TrimSuffix(c.Request.URL.Path, "/sign")
+	if request.Version > 0 {
+		path += "/versions/" + strconv.Itoa(request.Version)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url":        baseURL(c) + path + "?" + query.Encode(),
+		"expires_at": grant.ExpiresAt,
+	})
+}
+
+// Upload handles the POST request for uploading a file. The "file" part is
+// streamed straight into storage; "folder" or "folder_id" and "visibility"
+// fields must precede it.
+func (fc *FileController) Upload(c *gin.Context) {
+	var result map[string]interface{}
+	_, err := streamParts(c, maxFileSize+maxFieldSize, func(form url.Values, part *uploadPart) error {
+		if part.FieldName != "file" || result != nil {
+			return nil
+		}
+		tags, metadata, err := uploadMetadata(c, form)
+		if err != nil {
+			return err
+		}
+		folderID, err := parseFolderID(form.Get("folder_id"))
+		if err != nil {
+			return err
+		}
+		folder, err := uploadFolder(c, folderID, form.Get("folder"))
+		if err != nil {
+			return err
+		}
+
+		// Use the service to save file and metadata
+		result, err = service.UploadFile(c.Request.Context(), withUploadPolicy(c, service.UploadInput{
+			Reader:       part,
+			OriginalName: part.FileName,
+			MimeType:     part.ContentType,
+			Size:         -1,
+			Folder:       folder,
+			MaxSize:      maxFileSize,
+			Tags:         tags,
+			Metadata:     metadata,
+			UploadedBy:   middleware.GetSubject(c),
+			Tenant:       middleware.GetTenant(c),
+			Visibility:   form.Get("visibility"),
+		}))
+		return err
+	})
+	if err != nil {
+		abortUpload(c, err)
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File not provided"})
 		return
 	}
 
@@ -47,95 +208,267 @@ func (fc *FileController) Upload(c *gin.Context) {
 	})
 }
 
-// UploadProductImages handles multiple product image uploads
+// Batch modes for UploadProductImages
+const (
+	batchAtomic  = "atomic"  // every image is stored or none is
+	batchPartial = "partial" // each image succeeds or fails on its own
+)
+
+// UploadProductImages handles multiple product image uploads. In the default
+// atomic mode the whole batch is committed in one transaction and nothing is
+// kept when any image fails. With ?mode=partial every image is stored on its
+// own and a per-file status array is returned with 207 Multi-Status when some
+// of them failed.
 func (fc *FileController) UploadProductImages(c *gin.Context) {
-	// Get all files from the form-data with the key "product_images"
-	form, err := c.MultipartForm()
+	switch mode := c.DefaultQuery("mode", batchAtomic); mode {
+	case batchAtomic:
+		uploadProductImagesAtomic(c)
+	case batchPartial:
+		uploadProductImagesPartial(c)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be atomic or partial"})
+	}
+}
+
+// productImageInput describes a streamed "product_images" part, stored in the
+// folder and tagged with the metadata fields preceding it
+func productImageInput(c *gin.Context, form url.Values, part *uploadPart) (service.UploadInput, error) {
+	tags, metadata, err := uploadMetadata(c, form)
+	if err != nil {
+		return service.UploadInput{}, err
+	}
+	folderID, err := parseFolderID(form.Get("folder_id"))
+	if err != nil {
+		return service.UploadInput{}, err
+	}
+	folder, err := uploadFolder(c, folderID, form.Get("folder"))
+	if err != nil {
+		return service.UploadInput{}, err
+	}
+	return withUploadPolicy(c, service.UploadInput{
+		Reader:       part,
+		OriginalName: part.FileName,
+		MimeType:     part.ContentType,
+		Size:         -1,
+		Folder:       folder,
+		MaxSize:      maxFileSize,
+		Tags:         tags,
+		Metadata:     metadata,
+		UploadedBy:   middleware.GetSubject(c),
+		Tenant:       middleware.GetTenant(c),
+		Visibility:   form.Get("visibility"),
+	}), nil
+}
+
+// uploadProductImagesAtomic stages every image and commits them together
+func uploadProductImagesAtomic(c *gin.Context) {
+	batch := &service.Batch{}
+	count := 0
+	_, err := streamParts(c, maxFileSize, func(form url.Values, part *uploadPart) error {
+		if part.FieldName != "product_images" {
+			return nil
+		}
+		count++
+		in, err := productImageInput(c, form, part)
+		if err != nil {
+			return err
+		}
+		if err := batch.Stage(c.Request.Context(), in); err != nil {
+			return fmt.Errorf("%s: %w", part.FileName, err)
+		}
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form"})
+		batch.Abort()
+		abortUpload(c, err)
 		return
 	}
-	files := form.File["product_images"]
-	if len(files) == 0 {
+	if count == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
 		return
 	}
 
-	var results []map[string]interface{}
-	for _, file := range files {
-		// Call service to handle each file upload
-		filename, err := service.UploadProductImage(file)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		results = append(results, filename)
+	files, err := batch.Commit(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	// Return an array of filenames for all uploaded files
+	results := make([]map[string]interface{}, 0, len(files))
+	for _, file := range files {
+		results = append(results, service.FileResponse(file))
+	}
 	c.JSON(http.StatusOK, gin.H{"files": results})
 }
 
+// uploadProductImagesPartial stores each image independently and reports a status per file
+func uploadProductImagesPartial(c *gin.Context) {
+	results := []gin.H{}
+	failed, reported := false, false
+	_, err := streamParts(c, maxFileSize, func(form url.Values, part *uploadPart) error {
+		if part.FieldName != "product_images" {
+			return nil
+		}
+		result := gin.H{"index": len(results), "originalname": part.FileName}
+
+		// Call service to handle each file upload
+		in, err := productImageInput(c, form, part)
+		var file map[string]interface{}
+		if err == nil {
+			file, err = service.UploadProductImage(c.Request.Context(), in)
+		}
+		if err != nil {
+			failed = true
+			result["status"] = uploadErrorStatus(c, err)
+			result["error"] = err.Error()
+		} else {
+			result["status"] = http.StatusCreated
+			result["file"] = file
+		}
+		results = append(results, result)
+
+		// An oversized body cannot be read further; it stops the stream and is
+		// reported on the file it cut short
+		if errors.Is(err, service.ErrRequestTooLarge) {
+			reported = true
+			return err
+		}
+		return nil
+	})
+	if err != nil && len(results) == 0 {
+		abortUpload(c, err)
+		return
+	}
+	if err != nil && !reported {
+		// The stream broke mid-request; files stored so far are kept and reported
+		failed = true
+		results = append(results, gin.H{"index": len(results), "status": uploadErrorStatus(c, err), "error": err.Error()})
+	}
+	if len(results) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
+		return
+	}
 
+	status := http.StatusOK
+	if failed {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{"files": results})
+}
 
-// Base64Upload handles the POST request for uploading a base64 encoded image
+// Base64Upload handles the POST request for uploading a base64 encoded file.
+// The "image" field accepts either a data URI or raw (standard or URL-safe) base64.
 func (fc *FileController) Base64Upload(c *gin.Context) {
 	var request struct {
-		Folder string `json:"folder"`
-		Image  string `json:"image"`
+		Folder     string                 `json:"folder"`
+		FolderID   *uint                  `json:"folder_id"`
+		Visibility string                 `json:"visibility"`
+		Image      string                 `json:"image"`
+		Filename   string                 `json:"filename"`
+		Tags       []string               `json:"tags"`
+		Metadata   map[string]interface{} `json:"metadata"`
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
+	// The validation middleware already read the body; bind from its cached copy
+	if err := c.ShouldBindBodyWith(&request, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	buffer, err := base64.StdEncoding.DecodeString(request.Image)
+	tags, metadata, err := uploadMetadata(c, url.Values{})
+	if err == nil {
+		err = mergeMetadata(metadata, request.Metadata)
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid base64 data"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	destinationFolder := filepath.Join("public/uploads", sanitize(request.Folder))
-	if err := os.MkdirAll(destinationFolder, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create directory"})
+	declared, buffer, err := decodeBase64Payload(request.Image)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid base64 data"})
 		return
 	}
 
-	fileName := uuid.New().String()
-	filePath := filepath.Join(destinationFolder, fileName)
-
-	if err := ioutil.WriteFile(filePath, buffer, 0644); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write file"})
-		return
+	originalName := request.Filename
+	if originalName == "" {
+		originalName = "base64-upload"
 	}
-
-	if isValid, err := verifyFile(filePath); !isValid {
-		os.Remove(filePath)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File verification failed: " + err.Error()})
+	folder, err := uploadFolder(c, request.FolderID, request.Folder)
+	if err != nil {
+		abortUpload(c, err)
 		return
 	}
 
-	// url, err := service.UploadFileByPath(filePath)
+	// The content type is detected from the decoded bytes and checked against
+	// the data URI, then stored through the same path as multipart uploads
+	result, err := service.UploadFile(c.Request.Context(), withUploadPolicy(c, service.UploadInput{
+		Reader:       bytes.NewReader(buffer),
+		OriginalName: originalName,
+		MimeType:     declared,
+		Size:         int64(len(buffer)),
+		Folder:       folder,
+		MaxSize:      maxFileSize,
+		MinSize:      1,
+		Tags:         append(tags, request.Tags...),
+		Metadata:     metadata,
+		UploadedBy:   middleware.GetSubject(c),
+		Tenant:       middleware.GetTenant(c),
+		Visibility:   request.Visibility,
+	}))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortUpload(c, err)
 		return
 	}
 
-	// c.JSON(http.StatusOK, gin.H{"url": url})
+	c.JSON(http.StatusOK, gin.H{
+		"file": result,
+	})
+}
+
+// decodeBase64Payload decodes a data URI or raw base64 string, returning the
+// declared mime type of data URIs. Whitespace, URL-safe characters and
+// missing padding are tolerated.
+func decodeBase64Payload(payload string) (string, []byte, error) {
+	declared := ""
+	if strings.HasPrefix(payload, "data:") {
+		comma := strings.IndexByte(payload, ',')
+		if comma < 0 || !strings.HasSuffix(payload[:comma], ";base64") {
+			return "", nil, errors.New("data uri must be base64 encoded")
+		}
+		declared = strings.Split(strings.TrimPrefix(payload[:comma], "data:"), ";")[0]
+		payload = payload[comma+1:]
+	}
+
+	payload = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		case '-':
+			return '+'
+		case '_':
+			return '/'
+		}
+		return r
+	}, payload)
+	buffer, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+	return declared, buffer, err
 }
 
-func sanitize(text string) string {
-	return strings.ToLower(strings.ReplaceAll(text, " ", "_"))
+// requestURL rebuilds the absolute URL of the current request
+func requestURL(c *gin.Context) string {
+	return baseURL(c) + c.Request.URL.Path
 }
 
-func verifyFile(filePath string) (bool, error) {
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return false, errors.New("failed to access file")
+// baseURL returns the scheme and host the client used to reach the service
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
 	}
-	if fileInfo.Size() == 0 {
-		return false, errors.New("empty file")
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
 	}
-	return true, nil
+	return scheme + "://" + c.Request.Host
 }
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"errors"
+	"my-project/middleware"
+	"my-project/models"
+	"my-project/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FolderController struct{}
+
+// Create handles the POST request creating a folder, at the root unless a parent is given
+func (fc *FolderController) Create(c *gin.Context) {
+	var request struct {
+		Name     string `json:"name" binding:"required"`
+		ParentID *uint  `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if !authorizeFolder(c, request.ParentID, service.PermWrite) {
+		return
+	}
+	folder, err := service.CreateFolder(middleware.GetTenant(c), request.Name, request.ParentID, middleware.GetSubject(c))
+	if err != nil {
+		folderError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"folder": folder})
+}
+
+// Root handles the GET request listing the folders and files at the root
+func (fc *FolderController) Root(c *gin.Context) {
+	listChildren(c, nil)
+}
+
+// Read handles the GET request for a folder with its child folders and files
+func (fc *FolderController) Read(c *gin.Context) {
+	id, ok := folderParam(c)
+	if !ok || !authorizeFolder(c, &id, service.PermRead) {
+		return
+	}
+	folder, err := service.GetFolder(middleware.GetTenant(c), id)
+	if err != nil {
+		folderError(c, err)
+		return
+	}
+	listChildren(c, folder)
+}
+
+// Rename handles the PATCH request changing the name of a folder
+func (fc *FolderController) Rename(c *gin.Context) {
+	id, ok := folderParam(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if !authorizeFolder(c, &id, service.PermWrite) {
+		return
+	}
+	folder, err := service.RenameFolder(middleware.GetTenant(c), id, request.Name)
+	if err != nil {
+		folderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"folder": folder})
+}
+
+// Move handles the POST request moving a folder with its content under
+// another folder, or to the root when parent_id is null
+func (fc *FolderController) Move(c *gin.Context) {
+	id, ok := folderParam(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if !authorizeFolder(c, &id, service.PermWrite) || !authorizeFolder(c, request.ParentID, service.PermWrite) {
+		return
+	}
+	folder, err := service.MoveFolder(middleware.GetTenant(c), id, request.ParentID)
+	if err != nil {
+		folderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"folder": folder})
+}
+
+// Delete handles the DELETE request removing a folder and its subfolders.
+// The files they contain are moved to the trash.
+func (fc *FolderController) Delete(c *gin.Context) {
+	id, ok := folderParam(c)
+	if !ok || !authorizeFolder(c, &id, service.PermDelete) {
+		return
+	}
+
+	trashed, err := service.DeleteFolder(middleware.GetTenant(c), id)
+	if err != nil {
+		folderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Folder deleted",
+		"trashed_files": trashed,
+	})
+}
+
+// Move handles the POST request moving a file into another folder, or to the
+// root when folder_id is null
+func (fc *FileController) Move(c *gin.Context) {
+	var request struct {
+		FolderID *uint `json:"folder_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	filename := c.Param("filename")
+	if !authorizeFile(c, middleware.GetTenant(c), filename, service.PermWrite, false) || !authorizeFolder(c, request.FolderID, service.PermWrite) {
+		return
+	}
+	file, err := service.MoveFile(middleware.GetTenant(c), filename, request.FolderID)
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		folderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"file": service.FileResponse(file)})
+}
+
+// listChildren renders the child folders of folder, nil for the root, and a
+// page of its files filtered like List
+func listChildren(c *gin.Context, folder *models.Folder) {
+	query, ok := bindFileQuery(c)
+	if !ok {
+		return
+	}
+
+	var parentID *uint
+	folderPath := ""
+	if folder != nil {
+		parentID = &folder.ID
+		folderPath = folder.Path
+	}
+	query.Folder = &folderPath
+
+	folders, err := service.ListFolders(middleware.GetTenant(c), parentID)
+	if err == nil {
+		folders, err = service.VisibleFolders(middleware.GetPrincipal(c), folders)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	listFiles(c, query, gin.H{
+		"folder":  folder,
+		"folders": folders,
+	})
+}
+
+// folderParam parses the :id path parameter
+func folderParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a positive integer"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// folderError answers a failed folder operation
+func folderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrFolderExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidFolder), errors.Is(err, service.ErrFolderCycle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
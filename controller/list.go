@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"errors"
+	"my-project/exceptions"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List handles the GET request for listing and searching files
+func (fc *FileController) List(c *gin.Context) {
+	query, ok := bindFileQuery(c)
+	if !ok {
+		return
+	}
+	listFiles(c, query, gin.H{})
+}
+
+// bindFileQuery reads the filters, sorting and pagination of a file listing
+func bindFileQuery(c *gin.Context) (service.FileQuery, bool) {
+	var query service.FileQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		exception := exceptions.NewUnprocessableEntityException("Invalid query", []string{err.Error()})
+		c.JSON(exception.StatusCode, exception)
+		return query, false
+	}
+	query.Meta = metaQuery(c.Request.URL.Query())
+	query.Tenant = middleware.GetTenant(c)
+	query.Viewer = middleware.GetPrincipal(c)
+	return query, true
+}
+
+// listFiles runs a file query and renders the page with its pagination
+// details alongside the given response fields
+func listFiles(c *gin.Context, query service.FileQuery, response gin.H) {
+	list, err := service.ListFiles(query)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		exception := exceptions.NewUnprocessableEntityException("Invalid query", []string{err.Error()})
+		c.JSON(exception.StatusCode, exception)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	files := make([]map[string]interface{}, 0, len(list.Files))
+	for i := range list.Files {
+		file := service.FileResponse(&list.Files[i])
+		if query.Trashed {
+			file["deleted_at"] = list.Files[i].DeletedAt.Time
+		}
+		files = append(files, file)
+	}
+
+	pagination := gin.H{"per_page": list.PerPage}
+	if query.Cursor != "" || query.Pagination == "cursor" {
+		pagination["next_cursor"] = list.NextCursor
+	} else {
+		pagination["page"] = list.Page
+		pagination["total"] = list.Total
+	}
+
+	response["files"] = files
+	response["pagination"] = pagination
+	c.JSON(http.StatusOK, response)
+}
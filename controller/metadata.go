@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadMetadata collects the tags and custom metadata of an upload from the
+// X-File-Tags and X-File-Metadata headers and from the form fields "tags",
+// "metadata" (a JSON object) and "meta.<key>" preceding the file part
+func uploadMetadata(c *gin.Context, form url.Values) ([]string, map[string]string, error) {
+	var tags []string
+	for _, value := range append(c.Request.Header.Values("X-File-Tags"), form["tags"]...) {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+
+	metadata := map[string]string{}
+	for _, raw := range append(c.Request.Header.Values("X-File-Metadata"), form["metadata"]...) {
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &values); err != nil {
+			return nil, nil, fmt.Errorf("%w: metadata must be a JSON object", service.ErrInvalidMetadata)
+		}
+		if err := mergeMetadata(metadata, values); err != nil {
+			return nil, nil, err
+		}
+	}
+	for key, values := range form {
+		if name := strings.TrimPrefix(key, "meta."); name != key && len(values) > 0 {
+			metadata[name] = values[len(values)-1]
+		}
+	}
+	return tags, metadata, nil
+}
+
+// mergeMetadata copies JSON values into metadata, keeping numbers and
+// booleans in their JSON text form. Nested values are rejected.
+func mergeMetadata(metadata map[string]string, values map[string]interface{}) error {
+	for key, value := range values {
+		text, err := metadataValue(value)
+		if err != nil {
+			return fmt.Errorf("%w: %q %s", service.ErrInvalidMetadata, key, err.Error())
+		}
+		metadata[key] = text
+	}
+	return nil
+}
+
+// metadataValue renders a scalar JSON value as text
+func metadataValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", errors.New("must be a string, number or boolean")
+}
+
+// metaQuery extracts the meta.<key> filters of a listing query
+func metaQuery(query url.Values) map[string]string {
+	meta := map[string]string{}
+	for key, values := range query {
+		if name := strings.TrimPrefix(key, "meta."); name != key && len(values) > 0 {
+			meta[name] = values[len(values)-1]
+		}
+	}
+	return meta
+}
+
+// UpdateMetadata handles the PATCH request changing the tags and metadata of a
+// file. "tags" replaces every tag; each "metadata" key is set, or removed when null.
+func (fc *FileController) UpdateMetadata(c *gin.Context) {
+	var request struct {
+		Tags     *[]string              `json:"tags"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	update := service.MetadataUpdate{Tags: request.Tags, Metadata: map[string]*string{}}
+	for key, value := range request.Metadata {
+		if value == nil {
+			update.Metadata[key] = nil
+			continue
+		}
+		text, err := metadataValue(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %q %s", service.ErrInvalidMetadata, key, err)})
+			return
+		}
+		update.Metadata[key] = &text
+	}
+
+	if !authorizeFile(c, middleware.GetTenant(c), c.Param("filename"), service.PermWrite, false) {
+		return
+	}
+	file, err := service.UpdateMetadata(middleware.GetTenant(c), c.Param("filename"), update)
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidMetadata) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file": service.FileResponse(file)})
+}
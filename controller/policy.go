@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"errors"
+	"my-project/config"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errMissingPolicy is returned when the file part arrives before the policy fields
+var errMissingPolicy = errors.New("policy and signature fields must be sent before the file")
+
+// CreateUploadPolicy handles the POST request issuing a signed policy for a direct browser upload
+func (fc *FileController) CreateUploadPolicy(c *gin.Context) {
+	var request struct {
+		AllowedTypes []string `json:"allowed_types"`
+		MinSize      int64    `json:"min_size"`
+		MaxSize      int64    `json:"max_size"`
+		Folder       string   `json:"folder"`
+		FolderID     *uint    `json:"folder_id"`
+		Visibility   string   `json:"visibility"`
+		ExpiresIn    int64    `json:"expires_in"` // seconds, defaults to URL_SIGNING_TTL
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	folder, err := uploadFolder(c, request.FolderID, request.Folder)
+	switch {
+	case errors.Is(err, service.ErrInvalidFolder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case !permissionGranted(c, err, service.PermWrite, "folder"):
+		return
+	}
+	if request.MaxSize == 0 || request.MaxSize > maxFileSize {
+		request.MaxSize = maxFileSize
+	}
+
+	ttl := time.Duration(request.ExpiresIn) * time.Second
+	if cfg := config.LoadSigningConfig(); ttl <= 0 || ttl > cfg.MaxTTL {
+		ttl = cfg.DefaultTTL
+	}
+
+	policy := service.UploadPolicy{
+		Expiration:   time.Now().Add(ttl).Truncate(time.Second),
+		AllowedTypes: request.AllowedTypes,
+		MinSize:      request.MinSize,
+		MaxSize:      request.MaxSize,
+		Folder:       folder,
+		UploadedBy:   middleware.GetSubject(c),
+		Tenant:       middleware.GetTenant(c),
+		Visibility:   request.Visibility,
+	}
+	encoded, signature, err := service.SignUploadPolicy(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url": baseURL(c) + "/api/file/upload-direct",
+		"fields": gin.H{
+			"policy":    encoded,
+			"signature": signature,
+		},
+		"expires_at": policy.Expiration,
+	})
+}
+
+// DirectUpload handles a multipart POST authenticated only by a signed upload
+// policy. The "policy" and "signature" fields must precede the "file" part so
+// the conditions are enforced before anything is persisted.
+func (fc *FileController) DirectUpload(c *gin.Context) {
+	var result map[string]interface{}
+	_, err := streamParts(c, maxFileSize+maxFieldSize, func(form url.Values, part *uploadPart) error {
+		if part.FieldName != "file" || result != nil {
+			return nil
+		}
+
+		if form.Get("policy") == "" {
+			return errMissingPolicy
+		}
+		policy, err := service.VerifyUploadPolicy(form.Get("policy"), form.Get("signature"))
+		if err != nil {
+			return err
+		}
+
+		tags, metadata, err := uploadMetadata(c, form)
+		if err != nil {
+			return err
+		}
+
+		result, err = service.UploadFile(c.Request.Context(), service.UploadInput{
+			Reader:       part,
+			OriginalName: part.FileName,
+			MimeType:     part.ContentType,
+			Size:         -1,
+			Folder:       policy.Folder,
+			MaxSize:      policy.MaxSize,
+			MinSize:      policy.MinSize,
+			AllowedTypes: policy.AllowedTypes,
+			Tags:         tags,
+			Metadata:     metadata,
+			UploadedBy:   policy.UploadedBy,
+			Tenant:       policy.Tenant,
+			Visibility:   policy.Visibility,
+		})
+		return err
+	})
+	if err != nil {
+		policyError(c, err)
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File not provided"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file": result,
+	})
+}
+
+// policyError rejects uploads without a valid policy, and answers the
+// content breaking its conditions like any upload error
+func policyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errMissingPolicy), errors.Is(err, service.ErrInvalidSignature), errors.Is(err, service.ErrPolicyExpired),
+		errors.Is(err, service.ErrSigningDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		abortUpload(c, err)
+	}
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"my-project/exceptions"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maximum file size (512MB)
+const maxFileSize = 512 * 1024 * 1024
+
+// maxFieldSize caps the size of a single non-file form field
+const maxFieldSize = 1 << 20
+
+// Errors returned while streaming a multipart request
+var (
+	errNotMultipart = errors.New("request is not multipart/form-data")
+	errFieldTooLong = errors.New("form field is too large")
+	errTooManyFiles = errors.New("too many files in request")
+)
+
+// uploadPart is a file part of a multipart request being streamed
+type uploadPart struct {
+	FieldName   string
+	FileName    string
+	ContentType string
+	io.Reader
+}
+
+// streamParts walks the multipart body part by part without buffering files
+// to memory or temporary files. Text fields are collected into form as they
+// arrive, so fields sent before a file part are visible to onFile. The body
+// is capped at maxBody bytes; anything larger fails with service.ErrRequestTooLarge.
+// The number of file parts is limited by the upload policy of the route.
+func streamParts(c *gin.Context, maxBody int64, onFile func(form url.Values, part *uploadPart) error) (url.Values, error) {
+	form := url.Values{}
+
+	// Reject oversized requests before reading a single byte
+	if c.Request.ContentLength > maxBody {
+		return form, service.ErrRequestTooLarge
+	}
+
+	maxFiles := 0
+	if policy := middleware.GetUploadPolicy(c); policy != nil {
+		maxFiles = policy.MaxFiles
+	}
+	files := 0
+	countFile := func() error {
+		files++
+		if maxFiles > 0 && files > maxFiles {
+			return fmt.Errorf("%w: at most %d allowed", errTooManyFiles, maxFiles)
+		}
+		return nil
+	}
+
+	// Middleware may already have parsed the form; fall back to the parsed parts
+	if c.Request.MultipartForm != nil {
+		return streamParsedParts(c.Request.MultipartForm, func(form url.Values, part *uploadPart) error {
+			if err := countFile(); err != nil {
+				return err
+			}
+			return onFile(form, part)
+		})
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return form, errNotMultipart
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return form, streamError(err)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+			part.Close()
+			if err != nil {
+				return form, streamError(err)
+			}
+			if len(value) > maxFieldSize {
+				return form, errFieldTooLong
+			}
+			form.Add(part.FormName(), string(value))
+			continue
+		}
+
+		if err := countFile(); err != nil {
+			part.Close()
+			return form, err
+		}
+		err = onFile(form, &uploadPart{
+			FieldName:   part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Reader:      part,
+		})
+		part.Close()
+		if err != nil {
+			return form, streamError(err)
+		}
+	}
+}
+
+// streamParsedParts replays an already parsed form through onFile
+func streamParsedParts(parsed *multipart.Form, onFile func(form url.Values, part *uploadPart) error) (url.Values, error) {
+	form := url.Values(parsed.Value)
+	for field, files := range parsed.File {
+		for _, header := range files {
+			src, err := header.Open()
+			if err != nil {
+				return form, err
+			}
+			err = onFile(form, &uploadPart{
+				FieldName:   field,
+				FileName:    header.Filename,
+				ContentType: header.Header.Get("Content-Type"),
+				Reader:      src,
+			})
+			src.Close()
+			if err != nil {
+				return form, err
+			}
+		}
+	}
+	return form, nil
+}
+
+// streamError turns a body size overflow into service.ErrRequestTooLarge
+func streamError(err error) error {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return service.ErrRequestTooLarge
+	}
+	return err
+}
+
+// withUploadPolicy tightens the limits of an upload with the policy attached to the route
+func withUploadPolicy(c *gin.Context, in service.UploadInput) service.UploadInput {
+	policy := middleware.GetUploadPolicy(c)
+	if policy == nil {
+		return in
+	}
+	if policy.MaxSize > 0 && (in.MaxSize == 0 || policy.MaxSize < in.MaxSize) {
+		in.MaxSize = policy.MaxSize
+	}
+	if policy.MinSize > in.MinSize {
+		in.MinSize = policy.MinSize
+	}
+	if len(policy.AllowedTypes) > 0 {
+		in.AllowedTypes = policy.AllowedTypes
+	}
+	in.MinWidth = policy.MinWidth
+	in.MaxWidth = policy.MaxWidth
+	in.MinHeight = policy.MinHeight
+	in.MaxHeight = policy.MaxHeight
+	in.Presets = policy.Presets
+	in.StripMetadata = policy.StripMetadata
+	in.ExifFields = policy.ExifFields
+	return in
+}
+
+// isPolicyViolation reports whether err breaks a rule an upload policy can set
+func isPolicyViolation(err error) bool {
+	for _, target := range []error{
+		service.ErrFileTooLarge, service.ErrFileTooSmall, service.ErrTypeNotAllowed,
+		service.ErrImageDimensions, service.ErrImageUnreadable, service.ErrImageTooLarge, errTooManyFiles,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadErrorStatus maps upload errors to HTTP status codes
+func uploadErrorStatus(c *gin.Context, err error) int {
+	if middleware.GetUploadPolicy(c) != nil && isPolicyViolation(err) {
+		return http.StatusUnprocessableEntity
+	}
+	switch {
+	case errors.Is(err, service.ErrFileTooLarge), errors.Is(err, service.ErrRequestTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrMimeMismatch), errors.Is(err, service.ErrExtMismatch), errors.Is(err, service.ErrTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrFileTooSmall), errors.Is(err, errNotMultipart), errors.Is(err, errFieldTooLong),
+		errors.Is(err, errTooManyFiles), errors.Is(err, service.ErrImageDimensions), errors.Is(err, service.ErrImageUnreadable),
+		errors.Is(err, service.ErrImageTooLarge),
+		errors.Is(err, service.ErrInvalidFolder), errors.Is(err, service.ErrInvalidMetadata), errors.Is(err, service.ErrInvalidVisibility):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// abortUpload answers an upload error, closing the connection when the
+// client may still be sending a body we refuse to read. Violations of the
+// route's upload policy are reported as an UnprocessableEntityException.
+func abortUpload(c *gin.Context, err error) {
+	status := uploadErrorStatus(c, err)
+	if status == http.StatusRequestEntityTooLarge || errors.Is(err, service.ErrFileTooLarge) {
+		c.Header("Connection", "close")
+	}
+	if status == http.StatusUnprocessableEntity {
+		policy := middleware.GetUploadPolicy(c)
+		exception := exceptions.NewUnprocessableEntityException("Upload policy "+policy.Name+" violated", []string{err.Error()})
+		c.JSON(exception.StatusCode, exception)
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"errors"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Delete handles the DELETE request moving a file to the trash
+func (fc *FileController) Delete(c *gin.Context) {
+	if !authorizeFile(c, middleware.GetTenant(c), c.Param("filename"), service.PermDelete, false) {
+		return
+	}
+	err := service.TrashFile(middleware.GetTenant(c), c.Param("filename"))
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File moved to trash"})
+}
+
+// Trash handles the GET request listing trashed files, with the same filters
+// and pagination as List
+func (fc *FileController) Trash(c *gin.Context) {
+	query, ok := bindFileQuery(c)
+	if !ok {
+		return
+	}
+	query.Trashed = true
+	listFiles(c, query, gin.H{})
+}
+
+// Restore handles the POST request bringing a file back from the trash
+func (fc *FileController) Restore(c *gin.Context) {
+	if !authorizeFile(c, middleware.GetTenant(c), c.Param("filename"), service.PermDelete, true) {
+		return
+	}
+	file, err := service.RestoreFile(middleware.GetTenant(c), c.Param("filename"))
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file": service.FileResponse(file)})
+}
+
+// Purge handles the DELETE request permanently removing a file and, when no
+// other file shares it, its stored object
+func (fc *FileController) Purge(c *gin.Context) {
+	if !authorizeFile(c, middleware.GetTenant(c), c.Param("filename"), service.PermDelete, true) {
+		return
+	}
+	err := service.PurgeTrashedFile(c.Request.Context(), middleware.GetTenant(c), c.Param("filename"))
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File permanently deleted"})
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"errors"
+	"my-project/config"
+	"my-project/middleware"
+	"my-project/models"
+	"my-project/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tus protocol constants
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+)
+
+// TusController implements the tus 1.0 core protocol with the creation and termination extensions
+type TusController struct{}
+
+// TusResumable rejects requests that do not speak a supported tus version
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			c.AbortWithStatus(http.StatusPreconditionFailed)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Options advertises the supported version, extensions and maximum size
+func (tc *TusController) Options(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(config.LoadTusConfig().MaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Create handles the creation extension: POST with Upload-Length and optional Upload-Metadata
+func (tc *TusController) Create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Length header"})
+		return
+	}
+
+	metadata := c.GetHeader("Upload-Metadata")
+	in, err := tusInput(c, metadata)
+	if err != nil {
+		tusError(c, err)
+		return
+	}
+	upload, err := service.CreateTusUpload(length, metadata, in)
+	if err != nil {
+		tusError(c, err)
+		return
+	}
+
+	c.Header("Location", requestURL(c)+"/"+upload.ID)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	setTusFileHeader(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// Head reports how many bytes of the upload have been received. An upload
+// whose bytes all arrived but could not be stored is finalized again first.
+func (tc *TusController) Head(c *gin.Context) {
+	upload, err := service.GetTusUpload(middleware.GetTenant(c), c.Param("id"))
+	if err != nil {
+		tusError(c, err)
+		return
+	}
+	if upload.FileID == nil && upload.Offset == upload.Length {
+		in, err := tusInput(c, upload.Metadata)
+		if err == nil {
+			upload, err = service.FinishTusUpload(c.Request.Context(), middleware.GetTenant(c), c.Param("id"), in)
+		}
+		if err != nil {
+			tusError(c, err)
+			return
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	setTusFileHeader(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// Patch appends a chunk to the upload at the offset given by Upload-Offset
+func (tc *TusController) Patch(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Offset header"})
+		return
+	}
+
+	// The folder is authorized again since its permissions may have changed
+	// since the upload was created
+	upload, err := service.GetTusUpload(middleware.GetTenant(c), c.Param("id"))
+	if err != nil {
+		tusError(c, err)
+		return
+	}
+	in, err := tusInput(c, upload.Metadata)
+	if err != nil {
+		tusError(c, err)
+		return
+	}
+	upload, err = service.AppendTusUpload(c.Request.Context(), middleware.GetTenant(c), c.Param("id"), offset, c.Request.Body, in)
+	if err != nil {
+		tusError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	setTusFileHeader(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// Delete handles the termination extension
+func (tc *TusController) Delete(c *gin.Context) {
+	if err := service.TerminateTusUpload(middleware.GetTenant(c), c.Param("id")); err != nil {
+		tusError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// tusInput describes the file an upload is stored as under the policy of the
+// route, once the caller may write to the folder its metadata names by path
+// or "folder_id"
+func tusInput(c *gin.Context, metadata string) (service.UploadInput, error) {
+	fields := service.ParseTusMetadata(metadata)
+	folderID, err := parseFolderID(fields["folder_id"])
+	if err != nil {
+		return service.UploadInput{}, err
+	}
+	folder, err := uploadFolder(c, folderID, fields["folder"])
+	if err != nil {
+		return service.UploadInput{}, err
+	}
+	return withUploadPolicy(c, service.UploadInput{
+		Folder:     folder,
+		MaxSize:    config.LoadTusConfig().MaxSize,
+		UploadedBy: middleware.GetSubject(c),
+		Tenant:     middleware.GetTenant(c),
+	}), nil
+}
+
+// setTusFileHeader exposes the uri of the stored file once the upload is complete
+func setTusFileHeader(c *gin.Context, upload *models.TusUpload) {
+	if upload.File != nil {
+		c.Header("Upload-File-Uri", upload.File.Filename)
+	}
+}
+
+// tusError maps service errors to tus status codes, and the others like
+// any upload error
+func tusError(c *gin.Context, err error) {
+	var status int
+	switch {
+	case errors.Is(err, service.ErrTusNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrTusOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrTusTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrTusCompleted):
+		status = http.StatusForbidden
+	default:
+		abortUpload(c, err)
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
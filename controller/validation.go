@@ -3,56 +3,61 @@ package controller
 import (
 	"errors"
 	"my-project/exceptions"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
 	"regexp"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
-// ValidationRequest validates the folder field
+// ValidationRequest validates the optional folder path and the image field
 func ValidationRequest(c *gin.Context) error {
 	var request struct {
-		Folder string `json:"folder" validate:"required,min=2,alphanum"`
+		Folder string `json:"folder"`
 		Image  string `json:"image" validate:"required"`
 	}
 
-	// Bind JSON input to the struct
-	if err := c.ShouldBindJSON(&request); err != nil {
+	// Bind JSON input to the struct, caching the body for the handler
+	if err := c.ShouldBindBodyWith(&request, binding.JSON); err != nil {
 		return err
 	}
 
-	// Validate folder with custom logic (for regex and length checks)
-	if request.Folder == "" {
-		return errors.New("Field folder is required")
-	} else if !isValidFolder(request.Folder) {
+	// Nested paths are accepted the way uploads store them; the root is the default
+	if _, err := service.UploadFolder(middleware.GetTenant(c), nil, request.Folder); err != nil {
 		return errors.New("Field folder is invalid")
 	}
 
 	// Validate image with base64 regex
-	if !isValidBase64Image(request.Image) {
+	if !isValidBase64Data(request.Image) {
 		return errors.New("Field image must be a valid base64")
 	}
 
 	return nil
 }
 
-// isValidFolder checks if the folder field is valid (only alphanumeric characters and hyphens allowed)
-func isValidFolder(folder string) bool {
-	re := regexp.MustCompile("^[A-Za-z0-9-]+$")
-	return re.MatchString(folder)
-}
+// base64DataPattern matches raw base64 (standard or URL-safe) or a base64 data URI
+var base64DataPattern = regexp.MustCompile(`^(data:[\w.+-]+/[\w.+-]+(;[\w.+-]+=[\w.+-]+)*;base64,)?[A-Za-z0-9+/_\-\s]+=*\s*$`)
 
-// isValidBase64Image checks if the image field contains valid base64 data for an image
-func isValidBase64Image(image string) bool {
-	// Check if it's a valid base64-encoded image (PNG, JPG, JPEG, GIF)
-	re := regexp.MustCompile(`^data:image\/(png|jpg|jpeg|gif);base64,[A-Za-z0-9+/=]+$`)
-	return re.MatchString(image)
+// isValidBase64Data checks if the image field contains a data URI or raw base64 data
+func isValidBase64Data(image string) bool {
+	return base64DataPattern.MatchString(image)
 }
 
 // UploadValidationMiddleware is a middleware that validates the request before processing
 func UploadValidationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		limitBase64Body(c)
+
 		// Validate request data
-		if err := ValidationRequest(c); err != nil {
+		err := ValidationRequest(c)
+		if errors.Is(streamError(err), service.ErrRequestTooLarge) {
+			abortUpload(c, service.ErrRequestTooLarge)
+			c.Abort()
+			return
+		}
+		if err != nil {
 			// Return Unprocessable Entity status with validation error
 			exception := exceptions.NewUnprocessableEntityException("Invalid Entity", []string{err.Error()})
 			c.JSON(exception.StatusCode, exception)
@@ -64,3 +69,13 @@ func UploadValidationMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// limitBase64Body caps the JSON body of a base64 upload to the encoded size
+// of the largest file the route's policy accepts, plus room for the other fields
+func limitBase64Body(c *gin.Context) {
+	limit := int64(maxFileSize)
+	if policy := middleware.GetUploadPolicy(c); policy != nil && policy.MaxSize > 0 {
+		limit = policy.MaxSize
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, (limit+2)/3*4+maxFieldSize)
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"errors"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Update handles the PUT request storing a new version of a file. The
+// previous content stays available in the version history.
+func (fc *FileController) Update(c *gin.Context) {
+	filename := c.Param("filename")
+	if !authorizeFile(c, middleware.GetTenant(c), filename, service.PermWrite, false) {
+		return
+	}
+
+	var result map[string]interface{}
+	_, err := streamParts(c, maxFileSize+maxFieldSize, func(form url.Values, part *uploadPart) error {
+		if part.FieldName != "file" || result != nil {
+			return nil
+		}
+		file, err := service.UpdateFile(c.Request.Context(), filename, withUploadPolicy(c, service.UploadInput{
+			Reader:       part,
+			OriginalName: part.FileName,
+			MimeType:     part.ContentType,
+			Size:         -1,
+			MaxSize:      maxFileSize,
+			UploadedBy:   middleware.GetSubject(c),
+			Tenant:       middleware.GetTenant(c),
+		}))
+		if err != nil {
+			return err
+		}
+		result = service.FileResponse(file)
+		return nil
+	})
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		abortUpload(c, err)
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File not provided"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file": result,
+	})
+}
+
+// Versions handles the GET request listing the version history of a file
+func (fc *FileController) Versions(c *gin.Context) {
+	if !authorizeFile(c, middleware.GetTenant(c), c.Param("filename"), service.PermRead, false) {
+		return
+	}
+	file, versions, err := service.ListVersions(middleware.GetTenant(c), c.Param("filename"))
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(versions))
+	for i := range versions {
+		results = append(results, service.VersionResponse(&versions[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"file":     service.FileResponse(file),
+		"versions": results,
+	})
+}
+
+// ReadVersion handles the GET request for reading a specific version of a file
+func (fc *FileController) ReadVersion(c *gin.Context) {
+	filename := c.Param("filename")
+	version, ok := versionParam(c)
+	if !ok {
+		return
+	}
+	tenant, download, ok := authorizeRead(c, filename, version, false)
+	if !ok {
+		return
+	}
+
+	err := service.ReadFileVersion(tenant, filename, version, download, c)
+	if errors.Is(err, service.ErrFileNotFound) || errors.Is(err, service.ErrVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// Rollback handles the POST request making a previous version current again
+func (fc *FileController) Rollback(c *gin.Context) {
+	version, ok := versionParam(c)
+	if !ok || !authorizeFile(c, middleware.GetTenant(c), c.Param("filename"), service.PermWrite, false) {
+		return
+	}
+
+	file, err := service.RollbackFile(c.Request.Context(), middleware.GetTenant(c), c.Param("filename"), version)
+	if errors.Is(err, service.ErrFileNotFound) || errors.Is(err, service.ErrVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file": service.FileResponse(file)})
+}
+
+// versionParam parses the :version path parameter
+func versionParam(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"errors"
+	"my-project/middleware"
+	"my-project/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetVisibility handles the PUT request making a file private or public,
+// which requires the share permission
+func (fc *FileController) SetVisibility(c *gin.Context) {
+	var request struct {
+		Visibility string `json:"visibility" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	filename := c.Param("filename")
+	if !authorizeFile(c, middleware.GetTenant(c), filename, service.PermShare, false) {
+		return
+	}
+	file, err := service.SetVisibility(middleware.GetTenant(c), filename, request.Visibility)
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidVisibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file": service.FileResponse(file)})
+}
+
+// Public handles the GET request delivering a public file without
+// credentials. Responses may be cached by browsers and CDNs.
+func (fc *FileController) Public(c *gin.Context) {
+	err := service.ServePublicFile(c.Param("filename"), c.Query("download") == "true", c)
+	if errors.Is(err, service.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -10,10 +10,37 @@ import (
 
 // Migrate will perform the database migration
 func Migrate(DB *gorm.DB) {
-	// Auto migrate the File model (will create the table if it doesn't exist)
-	if err := DB.AutoMigrate(&models.File{}); err != nil {
+	// Auto migrate every model (will create the tables if they don't exist)
+	if err := DB.AutoMigrate(models.Models()...); err != nil {
 		log.Fatalf("Error migrating database: %v", err)
 	}
+
+	// Folder paths and blob hashes used to be unique across the whole
+	// install, they are now unique per tenant
+	legacy := []struct {
+		model interface{}
+		index string
+	}{
+		{&models.Folder{}, "idx_folders_path"},
+		{&models.Blob{}, "idx_blobs_hash"},
+	}
+	for _, l := range legacy {
+		if DB.Migrator().HasIndex(l.model, l.index) {
+			if err := DB.Migrator().DropIndex(l.model, l.index); err != nil {
+				log.Fatalf("Error dropping index %s: %v", l.index, err)
+			}
+		}
+	}
+	// Files uploaded before storage disks existed recorded their path
+	// relative to the working directory, "public/uploads/...". Keys of the
+	// local disk are relative to its root, which holds those directories.
+	for _, model := range []interface{}{&models.File{}, &models.FileVersion{}} {
+		err := DB.Unscoped().Model(model).Where("disk = ? AND path LIKE ?", "local", "public/%").
+			UpdateColumn("path", gorm.Expr("SUBSTR(path, ?)", len("public/")+1)).Error
+		if err != nil {
+			log.Fatalf("Error rewriting legacy file paths: %v", err)
+		}
+	}
 	fmt.Println("Database migrated successfully")
 }
 
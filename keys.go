@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"my-project/service"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runKeysCommand manages API keys from the command line:
+//
+//	keys create [-tenant TENANT] -name NAME -scopes files:read,files:write [-expires 720h]
+//	keys list [-tenant TENANT]
+//	keys revoke [-tenant TENANT] ID
+func runKeysCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: keys create|list|revoke")
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ExitOnError)
+		tenant := flags.String("tenant", "", "tenant the key acts for, empty for the default one")
+		name := flags.String("name", "", "name of the key")
+		scopes := flags.String("scopes", "", "comma separated scopes: "+strings.Join(service.Scopes, ", "))
+		expires := flags.Duration("expires", 0, "lifetime of the key, 0 for no expiry")
+		flags.Parse(args[1:])
+
+		key, token, err := service.CreateAPIKey(*tenant, *name, strings.Split(*scopes, ","), *expires)
+		if err != nil {
+			log.Fatal("❌ Error creating API key: ", err)
+		}
+		fmt.Printf("✅ Created API key %d (%s), store it now as it cannot be shown again:\n%s\n", key.ID, key.Name, token)
+
+	case "list":
+		flags := flag.NewFlagSet("keys list", flag.ExitOnError)
+		tenant := flags.String("tenant", "", "tenant whose keys are listed")
+		flags.Parse(args[1:])
+
+		keys, err := service.ListAPIKeys(*tenant)
+		if err != nil {
+			log.Fatal("❌ Error listing API keys: ", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES\tLAST USED\tREVOKED")
+		for i := range keys {
+			key := service.APIKeyResponse(&keys[i])
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", keys[i].ID, keys[i].Name, key["prefix"],
+				strings.Join(service.KeyScopes(&keys[i]), ","), formatTime(keys[i].ExpiresAt),
+				formatTime(keys[i].LastUsedAt), formatTime(keys[i].RevokedAt))
+		}
+		w.Flush()
+
+	case "revoke":
+		flags := flag.NewFlagSet("keys revoke", flag.ExitOnError)
+		tenant := flags.String("tenant", "", "tenant of the key")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			log.Fatal("usage: keys revoke [-tenant TENANT] ID")
+		}
+		id, err := strconv.ParseUint(flags.Arg(0), 10, 64)
+		if err != nil {
+			log.Fatal("❌ Invalid API key id: ", flags.Arg(0))
+		}
+		if _, err := service.RevokeAPIKey(*tenant, uint(id)); err != nil {
+			log.Fatal("❌ Error revoking API key: ", err)
+		}
+		fmt.Printf("✅ Revoked API key %d\n", id)
+
+	default:
+		log.Fatalf("❌ Unknown keys command %q", args[0])
+	}
+}
+
+// formatTime renders an optional timestamp for the key listing
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
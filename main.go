@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"my-project/config"
 	"my-project/database"
 	"my-project/routes"
+	"my-project/service"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -33,9 +35,19 @@ func connectDatabase() {
 		log.Fatal("❌ Error connecting to database:", err)
 	}
 	database.Migrate(DB)
+	if err := service.SyncFolders(); err != nil {
+		log.Fatal("❌ Error syncing folders:", err)
+	}
 	fmt.Println("✅ Database connected successfully")
 }
 
+func connectStorage() {
+	if err := config.ConnectStorage(); err != nil {
+		log.Fatal("❌ Error configuring storage:", err)
+	}
+	fmt.Println("✅ Storage configured successfully")
+}
+
 func notFoundHandler(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Cannot %s %s", c.Request.Method, c.Request.URL)})
 }
@@ -60,7 +72,7 @@ func staticFileHandler(c *gin.Context) {
 		return
 	}
 
-	fullPath := filepath.Join("public", path)
+	fullPath := filepath.Join(config.StaticRoot, path)
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
@@ -84,7 +96,10 @@ func setupRouter() *gin.Engine {
 	api := r.Group("/api", errorHandler)
 	routes.SetupRoutes(api)
 
-	r.Static("/public", "./public")
+	// Only the bundled assets are served from disk; uploads live outside the
+	// web root and public files are delivered through the public routes
+	r.Static("/public/static", config.StaticRoot)
+	routes.SetupPublicRoutes(r.Group("/public"))
 	r.NoRoute(notFoundHandler)
 
 	return r
@@ -93,11 +108,14 @@ func setupRouter() *gin.Engine {
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3001")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-API-Key, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Metadata, Upload-File-Uri")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
-		if c.Request.Method == "OPTIONS" {
+		// Only answer CORS preflights here; plain OPTIONS requests such as
+		// tus discovery are routed to their handlers
+		if c.Request.Method == "OPTIONS" && c.GetHeader("Access-Control-Request-Method") != "" {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -109,6 +127,15 @@ func main() {
 	loadEnv()
 	connectDatabase()
 
+	// "keys ..." manages API keys instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		runKeysCommand(os.Args[2:])
+		return
+	}
+
+	connectStorage()
+	service.StartTrashSweeper(context.Background(), config.LoadTrashConfig(), config.LoadTusConfig())
+
 	r := setupRouter()
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -1,61 +1,41 @@
 package middleware
 
 import (
-	"mime/multipart"
-	"net/http"
+	"log"
+	"my-project/config"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SingleFileMulter is a middleware that handles single file upload validation
-func SingleFileMulter() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get the file from the request
-		file, err := c.FormFile("file")
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
-			c.Abort()
-			return
-		}
+// uploadPolicyKey is the context key holding the upload policy of a route
+const uploadPolicyKey = "uploadPolicy"
 
-		// Validate file type (allow only images, adjust as needed)
-		if !isAllowedFileType(file) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type"})
-			c.Abort()
-			return
-		}
+// UploadPolicy attaches the named upload policy from config to a route. Upload
+// handlers enforce it while streaming, since the body cannot be inspected here
+// without buffering it. An unknown name stops the service at startup.
+func UploadPolicy(name string) gin.HandlerFunc {
+	policies, err := config.LoadUploadPolicies()
+	if err != nil {
+		log.Fatal("❌ Error loading upload policies:", err)
+	}
+	policy, ok := policies[name]
+	if !ok {
+		log.Fatalf("❌ Unknown upload policy %q", name)
+	}
 
-		// Set file in context for later use
-		c.Set("uploadedFile", file)
+	return func(c *gin.Context) {
+		// Set policy in context for later use
+		c.Set(uploadPolicyKey, &policy)
 
 		// Proceed to the next handler
 		c.Next()
 	}
 }
 
-// isAllowedFileType checks if the file type is allowed
-func isAllowedFileType(file *multipart.FileHeader) bool {
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/png":  true,
-		"image/gif":  true,
-	}
-
-	// Open the file to read its MIME type
-	src, err := file.Open()
-	if err != nil {
-		return false
-	}
-	defer src.Close()
-
-	// Get the first 512 bytes to detect file type
-	buffer := make([]byte, 512)
-	_, err = src.Read(buffer)
-	if err != nil {
-		return false
+// GetUploadPolicy returns the upload policy attached to the current route, or nil
+func GetUploadPolicy(c *gin.Context) *config.UploadPolicy {
+	if value, ok := c.Get(uploadPolicyKey); ok {
+		return value.(*config.UploadPolicy)
 	}
-
-	// Detect the content type
-	contentType := http.DetectContentType(buffer)
-	return allowedTypes[contentType]
+	return nil
 }
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ACLEntry grants one permission on a file or a folder to a user, a group or
+// everyone. The entries of a folder also apply to everything below it.
+type ACLEntry struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	FileID        *uint     `gorm:"index" json:"-"`                                  // set for the entries of a file
+	FolderID      *uint     `gorm:"index" json:"-"`                                  // set for the entries of a folder
+	PrincipalType string    `gorm:"type:varchar(10);not null" json:"type"`           // user, group or public
+	PrincipalID   string    `gorm:"type:varchar(255);not null;default:''" json:"id"` // subject or group name, empty for public
+	Permission    string    `gorm:"type:varchar(10);not null" json:"permission"`     // read, write, delete or share
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
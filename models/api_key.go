@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// APIKey is a credential for the API. Only a hash of its secret is stored;
+// the full key is shown once when it is created.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Tenant     string     `gorm:"type:varchar(64);not null;default:''" json:"tenant"` // tenant the key acts for, empty for the default one
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null;uniqueIndex" json:"prefix"` // public part of the key, used to look it up
+	SecretHash string     `gorm:"type:char(64);not null" json:"-"`                     // hex encoded SHA-256 of the secret part
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"-"`                 // space separated
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Blob represents a content-addressed object shared by every File with the same bytes
+type Blob struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Tenant    string    `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_blobs_tenant_hash,priority:1" json:"-"` // content is only shared within a tenant
+	Hash      string    `gorm:"type:char(64);not null;uniqueIndex:idx_blobs_tenant_hash,priority:2" json:"hash"`            // hex encoded SHA-256 of the content
+	Disk      string    `gorm:"type:varchar(50);not null" json:"disk"`
+	Path      string    `gorm:"type:varchar(500);not null" json:"path"`
+	Size      int64     `gorm:"not null" json:"size"`
+	RefCount  int       `gorm:"not null;default:0" json:"ref_count"` // number of File and FileVersion rows pointing at this blob
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -7,3 +7,18 @@ import (
 
 // DB will hold the global database connection instance
 var DB *gorm.DB
+
+// Models lists every model that must be auto migrated
+func Models() []interface{} {
+	return []interface{}{
+		&Folder{},
+		&File{},
+		&Blob{},
+		&TusUpload{},
+		&FileVersion{},
+		&FileTag{},
+		&FileMeta{},
+		&APIKey{},
+		&ACLEntry{},
+	}
+}
@@ -1,19 +1,36 @@
 package models
 
 import (
-	"time"
 	"gorm.io/gorm"
+	"time"
 )
 
 // File represents the files table in the database
 type File struct {
-	ID           uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	Filename     string         `gorm:"type:varchar(255);not null" json:"filename"`
-	OriginalName string         `gorm:"type:varchar(255);not null" json:"originalname"`
-	MimeType     string         `gorm:"type:varchar(150);not null" json:"mimetype"`
-	Path         string         `gorm:"type:varchar(500);not null" json:"path"`
-	Size         int64          `gorm:"not null" json:"size"`
-	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID               uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Tenant           string         `gorm:"type:varchar(64);not null;default:'';index" json:"-"` // owning tenant, empty for the default one
+	Filename         string         `gorm:"type:varchar(255);not null;uniqueIndex" json:"filename"`
+	OriginalName     string         `gorm:"type:varchar(255);not null;index" json:"originalname"`
+	MimeType         string         `gorm:"type:varchar(150);not null;index" json:"mimetype"`                          // detected from the content
+	DeclaredMimeType string         `gorm:"type:varchar(150)" json:"declared_mimetype"`                                // as sent by the client
+	Disk             string         `gorm:"type:varchar(50);not null;default:local" json:"disk"`                       // storage disk holding the object
+	Path             string         `gorm:"type:varchar(500);not null" json:"path"`                                    // object key within the disk
+	FolderID         *uint          `gorm:"index" json:"folder_id"`                                                    // nil for the root
+	Folder           string         `gorm:"type:varchar(255);index:idx_files_folder_created,priority:1" json:"folder"` // path of the folder, empty for the root
+	Size             int64          `gorm:"not null;index" json:"size"`
+	BlobID           *uint          `gorm:"index" json:"-"`
+	Hash             string         `gorm:"type:varchar(64);index" json:"hash"` // SHA-256 of the content, shared with the blob
+	Media            MediaInfo      `gorm:"embedded" json:"media"`
+	Version          int            `gorm:"not null;default:1" json:"version"`                                     // current version, earlier ones live in FileVersion
+	UploadedBy       string         `gorm:"type:varchar(255);index" json:"uploaded_by,omitempty"`                  // subject that uploaded the current content
+	Visibility       string         `gorm:"type:varchar(10);not null;default:private;index" json:"visibility"`     // private or public
+	OwnerID          string         `gorm:"type:varchar(255);not null;default:'';index" json:"owner_id,omitempty"` // subject owning the file, empty for anonymous and legacy uploads
+	ParentID         *uint          `gorm:"index" json:"parent_id,omitempty"`                                      // original image of a preset derivative
+	Preset           string         `gorm:"type:varchar(50)" json:"preset,omitempty"`                              // preset that rendered this derivative
+	Derivatives      []File         `gorm:"foreignKey:ParentID" json:"derivatives,omitempty"`
+	Tags             []FileTag      `json:"tags"`
+	Metadata         []FileMeta     `json:"metadata"`
+	CreatedAt        time.Time      `gorm:"autoCreateTime;index;index:idx_files_folder_created,priority:2" json:"created_at"`
+	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
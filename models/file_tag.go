@@ -0,0 +1,22 @@
+package models
+
+// FileTag is a label attached to a file
+type FileTag struct {
+	ID     uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	FileID uint   `gorm:"not null;uniqueIndex:idx_file_tags_file_tag,priority:1" json:"-"`
+	Tag    string `gorm:"type:varchar(100);not null;uniqueIndex:idx_file_tags_file_tag,priority:2;index" json:"tag"`
+}
+
+// FileMeta is a custom key/value pair attached to a file. Values are kept as
+// text so they can be filtered on every supported database.
+type FileMeta struct {
+	ID     uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	FileID uint   `gorm:"not null;uniqueIndex:idx_file_meta_file_key,priority:1" json:"-"`
+	Key    string `gorm:"column:meta_key;type:varchar(100);not null;uniqueIndex:idx_file_meta_file_key,priority:2;index:idx_file_meta_key_value,priority:1" json:"key"`
+	Value  string `gorm:"column:meta_value;type:varchar(255);not null;index:idx_file_meta_key_value,priority:2" json:"value"`
+}
+
+// TableName keeps the table name singular like the metadata it holds
+func (FileMeta) TableName() string {
+	return "file_metadata"
+}
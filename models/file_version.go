@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// FileVersion is a previous content of a File, kept so it can be downloaded or rolled back to
+type FileVersion struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID           uint      `gorm:"not null;uniqueIndex:idx_file_versions_file_version,priority:1" json:"file_id"`
+	Version          int       `gorm:"not null;uniqueIndex:idx_file_versions_file_version,priority:2" json:"version"`
+	OriginalName     string    `gorm:"type:varchar(255);not null" json:"originalname"`
+	MimeType         string    `gorm:"type:varchar(150);not null" json:"mimetype"`
+	DeclaredMimeType string    `gorm:"type:varchar(150)" json:"declared_mimetype"`
+	Disk             string    `gorm:"type:varchar(50);not null" json:"disk"`
+	Path             string    `gorm:"type:varchar(500);not null" json:"path"`
+	Size             int64     `gorm:"not null" json:"size"`
+	BlobID           *uint     `gorm:"index" json:"-"`
+	Hash             string    `gorm:"type:varchar(64)" json:"hash"`
+	UploadedBy       string    `gorm:"type:varchar(255)" json:"uploaded_by,omitempty"`
+	Media            MediaInfo `gorm:"embedded" json:"media"`
+	File             *File     `json:"-"`
+	CreatedAt        time.Time `json:"created_at"` // when this content was uploaded
+}
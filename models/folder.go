@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Folder represents a node of the folder hierarchy files are uploaded into.
+// Files without a folder live at the root.
+type Folder struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Tenant    string    `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_folders_tenant_path,priority:1" json:"-"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	Parent    *Folder   `json:"-"`
+	Path      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_folders_tenant_path,priority:2" json:"path"` // slash separated names from the root, mirrored in File.Folder
+	OwnerID   string    `gorm:"type:varchar(255);not null;default:'';index" json:"owner_id,omitempty"`                 // subject owning the folder, empty for anonymous and legacy ones
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// MediaInfo describes the content of an image, document or audio/video file.
+// Fields that do not apply to a file are left empty.
+type MediaInfo struct {
+	Width     *int     `json:"width,omitempty"` // pixels, for images and videos
+	Height    *int     `json:"height,omitempty"`
+	PageCount *int     `json:"page_count,omitempty"` // for PDF documents
+	Duration  *float64 `json:"duration,omitempty"`   // seconds, for audio and video
+	Codec     string   `gorm:"type:varchar(100)" json:"codec,omitempty"`
+	// Placeholders shown while an image loads
+	BlurHash      string `gorm:"type:varchar(100)" json:"blurhash,omitempty"`
+	DominantColor string `gorm:"type:varchar(7)" json:"dominant_color,omitempty"` // "#rrggbb"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// TusUpload tracks a resumable upload created through the tus protocol
+type TusUpload struct {
+	ID         string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Tenant     string    `gorm:"type:varchar(64);not null;default:''" json:"-"`
+	Length     int64     `gorm:"column:upload_length;not null" json:"length"`
+	Offset     int64     `gorm:"column:upload_offset;not null;default:0" json:"offset"`
+	Metadata   string    `gorm:"type:text" json:"metadata"` // raw Upload-Metadata header
+	FileID     *uint     `gorm:"index" json:"file_id,omitempty"`
+	UploadedBy string    `gorm:"type:varchar(255)" json:"uploaded_by,omitempty"` // subject that created the upload
+	File       *File     `json:"file,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -2,13 +2,82 @@ package routes
 
 import (
 	"my-project/controller"
+	"my-project/middleware"
+	"my-project/service"
+
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRoutes(api *gin.RouterGroup) {
 	fileController := new(controller.FileController)
-    
-    api.GET("/file/:filename", fileController.Read)
-    api.POST("/file/upload-single", fileController.Upload) 
-	api.POST("/file/product/upload-image", fileController.UploadProductImages)
+	tusController := new(controller.TusController)
+	folderController := new(controller.FolderController)
+	apiKeyController := new(controller.APIKeyController)
+
+	read := middleware.RequireScope(service.ScopeFilesRead)
+	write := middleware.RequireScope(service.ScopeFilesWrite)
+	remove := middleware.RequireScope(service.ScopeFilesDelete)
+
+	api.GET("/files", read, fileController.List)
+	api.GET("/file/:filename", middleware.RequireScopeOrSignature(service.ScopeFilesRead), fileController.Read)
+	api.POST("/file/:filename/sign", read, fileController.Sign)
+	api.PUT("/file/:filename/visibility", write, fileController.SetVisibility)
+	api.PATCH("/file/:filename", write, fileController.UpdateMetadata)
+	api.POST("/file/:filename/move", write, fileController.Move)
+	api.DELETE("/file/:filename", remove, fileController.Delete)
+	api.POST("/file/:filename/restore", write, fileController.Restore)
+	api.POST("/file/upload-single", write, middleware.UploadPolicy("default"), fileController.Upload)
+	api.POST("/file/product/upload-image", write, middleware.UploadPolicy("product-images"), fileController.UploadProductImages)
+	api.POST("/file/upload-base64", write, middleware.UploadPolicy("default"), controller.UploadValidationMiddleware(), fileController.Base64Upload)
+
+	// Version history of a file
+	api.PUT("/file/:filename", write, middleware.UploadPolicy("default"), fileController.Update)
+	api.GET("/file/:filename/versions", read, fileController.Versions)
+	api.GET("/file/:filename/versions/:version", middleware.RequireScopeOrSignature(service.ScopeFilesRead), fileController.ReadVersion)
+	api.POST("/file/:filename/versions/:version/rollback", write, fileController.Rollback)
+
+	// Trash of soft deleted files
+	api.GET("/files/trash", read, fileController.Trash)
+	api.DELETE("/files/trash/:filename", remove, fileController.Purge)
+
+	// Folder hierarchy
+	api.GET("/folders", read, folderController.Root)
+	api.POST("/folders", write, folderController.Create)
+	api.GET("/folders/:id", read, folderController.Read)
+	api.PATCH("/folders/:id", write, folderController.Rename)
+	api.POST("/folders/:id/move", write, folderController.Move)
+	api.DELETE("/folders/:id", remove, folderController.Delete)
+
+	// Ownership and access control lists
+	api.GET("/file/:filename/permissions", read, fileController.Permissions)
+	api.PUT("/file/:filename/permissions", write, fileController.UpdatePermissions)
+	api.GET("/folders/:id/permissions", read, folderController.Permissions)
+	api.PUT("/folders/:id/permissions", write, folderController.UpdatePermissions)
+
+	// Direct browser uploads authorized by a signed policy
+	api.POST("/file/upload-policy", write, fileController.CreateUploadPolicy)
+	api.POST("/file/upload-direct", fileController.DirectUpload)
+
+	// Resumable uploads (tus 1.0 core, creation and termination)
+	tus := api.Group("/file/tus", controller.TusResumable())
+	tus.OPTIONS("", tusController.Options)
+	tus.POST("", write, middleware.UploadPolicy("default"), tusController.Create)
+	tus.HEAD("/:id", write, middleware.UploadPolicy("default"), tusController.Head)
+	tus.PATCH("/:id", write, middleware.UploadPolicy("default"), tusController.Patch)
+	tus.DELETE("/:id", write, tusController.Delete)
+
+	// Management of API keys
+	keys := api.Group("/keys", middleware.RequireScope(service.ScopeAdmin))
+	keys.GET("", apiKeyController.List)
+	keys.POST("", apiKeyController.Create)
+	keys.DELETE("/:id", apiKeyController.Revoke)
+}
+
+// SetupPublicRoutes registers the routes delivering public files without
+// credentials, mounted outside of the API
+func SetupPublicRoutes(public *gin.RouterGroup) {
+	fileController := new(controller.FileController)
+
+	public.GET("/files/:filename", fileController.Public)
+	public.HEAD("/files/:filename", fileController.Public)
 }
@@ -0,0 +1,508 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"my-project/config"
+	"my-project/models"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Permissions ACL entries grant on files and folders
+const (
+	PermRead   = "read"
+	PermWrite  = "write"
+	PermDelete = "delete"
+	PermShare  = "share" // change the entries and sign download URLs
+)
+
+// Permissions lists every permission an ACL entry can grant
+var Permissions = []string{PermRead, PermWrite, PermDelete, PermShare}
+
+// Kinds of principal an ACL entry applies to
+const (
+	GranteeUser   = "user"   // a subject, "key:<prefix>" for API keys
+	GranteeGroup  = "group"  // a group of the bearer token
+	GranteePublic = "public" // every caller of the tenant, anonymous ones included
+)
+
+// Errors returned by access control
+var (
+	ErrForbidden  = errors.New("permission denied")
+	ErrInvalidACL = errors.New("invalid access control list")
+)
+
+// Grant is the set of permissions held by a user, a group or everyone, the
+// form ACL entries are read and replaced in
+type Grant struct {
+	Type        string   `json:"type"`
+	ID          string   `json:"id,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// InheritedGrant is a grant applying through an enclosing folder
+type InheritedGrant struct {
+	Grant
+	Folder string `json:"folder"` // path of the folder holding the grant
+}
+
+// ACL describes who may access a file or folder
+type ACL struct {
+	Owner     string           `json:"owner"`
+	Grants    []Grant          `json:"grants"`
+	Inherited []InheritedGrant `json:"inherited"`
+}
+
+// access is the owner and the entries deciding the permissions on a file or
+// folder: its own ones and those of the folders above it
+type access struct {
+	owner     string
+	private   bool            // a private file, which anonymous callers only reach through grants
+	ancestors []models.Folder // enclosing folders, the folder itself included
+	entries   []models.ACLEntry
+}
+
+// allows reports whether p holds perm. Admins hold every permission, as do
+// the owners of the resource or of a folder above it. Resources without an
+// owner are reserved to admins, unless AUTH_REQUIRED is off and anonymous
+// callers may use them anyway, private files excepted.
+func (a *access) allows(p *Principal, perm string) bool {
+	if a.owns(p) || (a.owner == "" && !config.LoadAuthConfig().Required && (p != nil || !a.private)) {
+		return true
+	}
+	for _, entry := range a.entries {
+		if entry.Permission == perm && grantedTo(p, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// owns reports whether p may transfer the resource: an admin, its owner or
+// the owner of a folder above it. Only admins own resources without an owner.
+func (a *access) owns(p *Principal) bool {
+	if p == nil {
+		return false
+	}
+	if p.HasScope(ScopeAdmin) || (a.owner != "" && p.Subject == a.owner) {
+		return true
+	}
+	for _, folder := range a.ancestors {
+		if folder.OwnerID != "" && folder.OwnerID == p.Subject {
+			return true
+		}
+	}
+	return false
+}
+
+// grantedTo reports whether entry applies to p, nil for anonymous callers
+func grantedTo(p *Principal, entry models.ACLEntry) bool {
+	switch entry.PrincipalType {
+	case GranteePublic:
+		return true
+	case GranteeUser:
+		return p != nil && p.Subject != "" && p.Subject == entry.PrincipalID
+	case GranteeGroup:
+		return p != nil && slices.Contains(p.Groups, entry.PrincipalID)
+	}
+	return false
+}
+
+// ancestorPaths returns a folder path followed by the paths of the folders above it
+func ancestorPaths(folderPath string) []string {
+	var paths []string
+	for folderPath != "" {
+		paths = append(paths, folderPath)
+		i := strings.LastIndexByte(folderPath, '/')
+		if i < 0 {
+			break
+		}
+		folderPath = folderPath[:i]
+	}
+	return paths
+}
+
+// loadAccess gathers the folders of tenant enclosing folderPath and their
+// entries, with the entries of a file when fileID is set
+func loadAccess(tenant, owner, folderPath string, fileID *uint) (*access, error) {
+	a := &access{owner: owner}
+	if paths := ancestorPaths(folderPath); len(paths) > 0 {
+		if err := models.DB.Where("tenant = ? AND path IN ?", tenant, paths).Find(&a.ancestors).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]uint, 0, len(a.ancestors))
+	for _, folder := range a.ancestors {
+		ids = append(ids, folder.ID)
+	}
+	db := models.DB.Where("folder_id IN ?", ids)
+	if fileID != nil {
+		db = db.Or("file_id = ?", *fileID)
+	}
+	if err := db.Find(&a.entries).Error; err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// fileAccess loads the access of a file. Preset derivatives share the access
+// of their original.
+func fileAccess(file *models.File) (*access, error) {
+	if file.ParentID != nil {
+		var parent models.File
+		result := models.DB.Unscoped().Where("id = ?", *file.ParentID).Limit(1).Find(&parent)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			file = &parent
+		}
+	}
+	a, err := loadAccess(file.Tenant, file.OwnerID, file.Folder, &file.ID)
+	if err != nil {
+		return nil, err
+	}
+	a.private = file.Visibility != VisibilityPublic
+	return a, nil
+}
+
+// folderAccess loads the access of a folder
+func folderAccess(folder *models.Folder) (*access, error) {
+	return loadAccess(folder.Tenant, folder.OwnerID, folder.Path, nil)
+}
+
+// CheckFileAccess returns ErrForbidden unless p holds perm on file
+func CheckFileAccess(p *Principal, file *models.File, perm string) error {
+	a, err := fileAccess(file)
+	if err != nil {
+		return err
+	}
+	if !a.allows(p, perm) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CheckFolderAccess returns ErrForbidden unless p holds perm on folder
+func CheckFolderAccess(p *Principal, folder *models.Folder, perm string) error {
+	a, err := folderAccess(folder)
+	if err != nil {
+		return err
+	}
+	if !a.allows(p, perm) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeFile checks that p holds perm on a file of tenant, including
+// trashed ones when unscoped is set
+func AuthorizeFile(p *Principal, tenant, filename, perm string, unscoped bool) error {
+	file, err := findFile(tenant, filename, unscoped)
+	if err != nil {
+		return err
+	}
+	return CheckFileAccess(p, file, perm)
+}
+
+// AuthorizeFolder checks that p holds perm on a folder of tenant, nil being
+// the root which every caller may use
+func AuthorizeFolder(p *Principal, tenant string, id *uint, perm string) error {
+	folder, err := findParent(models.DB, tenant, id)
+	if err != nil || folder == nil {
+		return err
+	}
+	return CheckFolderAccess(p, folder, perm)
+}
+
+// AuthorizeFolderPath checks that p holds perm on the folder of tenant at a
+// cleaned path, or on its nearest existing ancestor when it is yet to be
+// created by an upload
+func AuthorizeFolderPath(p *Principal, tenant, folderPath, perm string) error {
+	a, err := loadAccess(tenant, "", folderPath, nil)
+	if err != nil || len(a.ancestors) == 0 {
+		return err
+	}
+	nearest := slices.MaxFunc(a.ancestors, func(x, y models.Folder) int {
+		return len(x.Path) - len(y.Path)
+	})
+	return CheckFolderAccess(p, &nearest, perm)
+}
+
+// VisibleFolders keeps the folders p may read
+func VisibleFolders(p *Principal, folders []models.Folder) ([]models.Folder, error) {
+	visible := make([]models.Folder, 0, len(folders))
+	for i := range folders {
+		err := CheckFolderAccess(p, &folders[i], PermRead)
+		if errors.Is(err, ErrForbidden) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		visible = append(visible, folders[i])
+	}
+	return visible, nil
+}
+
+// readableFiles restricts a listing of tenant to the files p may read
+func readableFiles(db *gorm.DB, p *Principal, tenant string) (*gorm.DB, error) {
+	if p != nil && p.HasScope(ScopeAdmin) {
+		return db, nil
+	}
+	folders, err := readableFolders(p, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := models.DB.Where("files.folder_id IN ?", folders)
+	if p != nil && p.Subject != "" {
+		owned = owned.Or("files.owner_id = ?", p.Subject)
+	}
+	if !config.LoadAuthConfig().Required {
+		// Anonymous callers only see the public ones of the ownerless files
+		if p != nil {
+			owned = owned.Or("files.owner_id = ''")
+		} else {
+			owned = owned.Or("files.owner_id = '' AND files.visibility = ?", VisibilityPublic)
+		}
+	}
+	grantee, args := granteeCondition(p)
+	args = append([]interface{}{PermRead}, args...)
+	return db.Where(owned.
+		Or("EXISTS (SELECT 1 FROM acl_entries WHERE acl_entries.file_id = files.id AND acl_entries.permission = ? AND ("+grantee+"))", args...)), nil
+}
+
+// readableFolders returns the ids of the folders of tenant whose files p may
+// read: those p owns or was granted read on, and every folder below them
+func readableFolders(p *Principal, tenant string) ([]uint, error) {
+	grantee, args := granteeCondition(p)
+	args = append([]interface{}{PermRead}, args...)
+	db := models.DB.Where("tenant = ?", tenant).Where(
+		models.DB.Where("id IN (SELECT acl_entries.folder_id FROM acl_entries WHERE acl_entries.permission = ? AND ("+grantee+"))", args...))
+	if p != nil && p.Subject != "" {
+		db = db.Or("tenant = ? AND owner_id = ?", tenant, p.Subject)
+	}
+	var roots []models.Folder
+	if err := db.Find(&roots).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	for i := range roots {
+		subtree, err := descendants(models.DB, &roots[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, folder := range subtree {
+			if !slices.Contains(ids, folder.ID) {
+				ids = append(ids, folder.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// granteeCondition matches the acl_entries rows applying to p
+func granteeCondition(p *Principal) (string, []interface{}) {
+	subject, groups := "", []string{}
+	if p != nil {
+		subject, groups = p.Subject, p.Groups
+	}
+	return "acl_entries.principal_type = ? OR (acl_entries.principal_type = ? AND acl_entries.principal_id = ? AND acl_entries.principal_id <> '') OR (acl_entries.principal_type = ? AND acl_entries.principal_id IN ?)",
+		[]interface{}{GranteePublic, GranteeUser, subject, GranteeGroup, groups}
+}
+
+// FileACL describes the owner and entries of a live file of tenant
+func FileACL(tenant, filename string) (*ACL, error) {
+	file, err := findFile(tenant, filename, false)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fileAccess(file)
+	if err != nil {
+		return nil, err
+	}
+	return a.describe(func(entry models.ACLEntry) bool { return entry.FileID != nil }), nil
+}
+
+// FolderACL describes the owner and entries of a folder of tenant
+func FolderACL(tenant string, id uint) (*ACL, error) {
+	folder, err := findFolder(models.DB, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	a, err := folderAccess(folder)
+	if err != nil {
+		return nil, err
+	}
+	return a.describe(func(entry models.ACLEntry) bool {
+		return entry.FolderID != nil && *entry.FolderID == folder.ID
+	}), nil
+}
+
+// describe groups the entries into grants, own tells the entries set on the
+// resource itself from the inherited ones
+func (a *access) describe(own func(models.ACLEntry) bool) *ACL {
+	paths := make(map[uint]string, len(a.ancestors))
+	for _, folder := range a.ancestors {
+		paths[folder.ID] = folder.Path
+	}
+
+	acl := &ACL{Owner: a.owner, Grants: []Grant{}, Inherited: []InheritedGrant{}}
+	for _, entry := range a.entries {
+		if own(entry) {
+			acl.Grants = addGrant(acl.Grants, entry)
+			continue
+		}
+		folder := paths[*entry.FolderID]
+		i := slices.IndexFunc(acl.Inherited, func(g InheritedGrant) bool {
+			return g.Folder == folder && g.Type == entry.PrincipalType && g.ID == entry.PrincipalID
+		})
+		if i < 0 {
+			acl.Inherited = append(acl.Inherited, InheritedGrant{Folder: folder, Grant: Grant{Type: entry.PrincipalType, ID: entry.PrincipalID}})
+			i = len(acl.Inherited) - 1
+		}
+		acl.Inherited[i].Permissions = append(acl.Inherited[i].Permissions, entry.Permission)
+	}
+	return acl
+}
+
+// addGrant adds the permission of entry to the grant of its principal
+func addGrant(grants []Grant, entry models.ACLEntry) []Grant {
+	i := slices.IndexFunc(grants, func(g Grant) bool {
+		return g.Type == entry.PrincipalType && g.ID == entry.PrincipalID
+	})
+	if i < 0 {
+		return append(grants, Grant{Type: entry.PrincipalType, ID: entry.PrincipalID, Permissions: []string{entry.Permission}})
+	}
+	grants[i].Permissions = append(grants[i].Permissions, entry.Permission)
+	return grants
+}
+
+// ACLUpdate replaces the grants of a file or folder and optionally transfers it
+type ACLUpdate struct {
+	Owner  *string
+	Grants []Grant
+}
+
+// aclEntries validates grants and expands them to one entry per permission
+func aclEntries(grants []Grant) ([]models.ACLEntry, error) {
+	var entries []models.ACLEntry
+	seen := map[string]bool{}
+	for _, grant := range grants {
+		grant.ID = strings.TrimSpace(grant.ID)
+		switch grant.Type {
+		case GranteeUser, GranteeGroup:
+			if grant.ID == "" || len(grant.ID) > 255 {
+				return nil, fmt.Errorf("%w: a %s grant needs an id of at most 255 characters", ErrInvalidACL, grant.Type)
+			}
+		case GranteePublic:
+			if grant.ID != "" {
+				return nil, fmt.Errorf("%w: a public grant has no id", ErrInvalidACL)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown grantee type %q", ErrInvalidACL, grant.Type)
+		}
+		for _, perm := range grant.Permissions {
+			if !slices.Contains(Permissions, perm) {
+				return nil, fmt.Errorf("%w: unknown permission %q", ErrInvalidACL, perm)
+			}
+			key := grant.Type + "\x00" + grant.ID + "\x00" + perm
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			entries = append(entries, models.ACLEntry{PrincipalType: grant.Type, PrincipalID: grant.ID, Permission: perm})
+		}
+	}
+	return entries, nil
+}
+
+// UpdateFileACL lets p, who must hold the share permission, replace the
+// entries of a live file of tenant. Transferring the file also requires owning it.
+func UpdateFileACL(p *Principal, tenant, filename string, update ACLUpdate) (*ACL, error) {
+	file, err := findFile(tenant, filename, false)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fileAccess(file)
+	if err != nil {
+		return nil, err
+	}
+	err = a.update(p, update, func(tx *gorm.DB, entries []models.ACLEntry) error {
+		if err := tx.Where("file_id = ?", file.ID).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
+		for i := range entries {
+			entries[i].FileID = &file.ID
+		}
+		if update.Owner == nil {
+			return nil
+		}
+		return tx.Unscoped().Model(&models.File{}).Where("id = ? OR parent_id = ?", file.ID, file.ID).
+			UpdateColumn("owner_id", strings.TrimSpace(*update.Owner)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return FileACL(tenant, filename)
+}
+
+// UpdateFolderACL lets p, who must hold the share permission, replace the
+// entries of a folder of tenant. Transferring the folder also requires owning it.
+func UpdateFolderACL(p *Principal, tenant string, id uint, update ACLUpdate) (*ACL, error) {
+	folder, err := findFolder(models.DB, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	a, err := folderAccess(folder)
+	if err != nil {
+		return nil, err
+	}
+	err = a.update(p, update, func(tx *gorm.DB, entries []models.ACLEntry) error {
+		if err := tx.Where("folder_id = ?", folder.ID).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
+		for i := range entries {
+			entries[i].FolderID = &folder.ID
+		}
+		if update.Owner == nil {
+			return nil
+		}
+		return tx.Model(folder).UpdateColumn("owner_id", strings.TrimSpace(*update.Owner)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return FolderACL(tenant, id)
+}
+
+// update checks the permissions of p and stores the entries once replace
+// has dropped the previous ones and attached the new ones to the resource
+func (a *access) update(p *Principal, update ACLUpdate, replace func(*gorm.DB, []models.ACLEntry) error) error {
+	if !a.allows(p, PermShare) || (update.Owner != nil && !a.owns(p)) {
+		return ErrForbidden
+	}
+	entries, err := aclEntries(update.Grants)
+	if err != nil {
+		return err
+	}
+	if update.Owner != nil && len(strings.TrimSpace(*update.Owner)) > 255 {
+		return fmt.Errorf("%w: owner is longer than 255 characters", ErrInvalidACL)
+	}
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := replace(tx, entries); err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(&entries).Error
+	})
+}
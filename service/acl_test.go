@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"my-project/models"
+	"slices"
+	"testing"
+)
+
+func TestAccessAllows(t *testing.T) {
+	alice := &Principal{Subject: "alice", Scopes: []string{ScopeFilesRead}}
+	bob := &Principal{Subject: "bob", Scopes: []string{ScopeFilesRead}, Groups: []string{"design"}}
+	admin := &Principal{Subject: "root", Scopes: []string{ScopeAdmin}}
+	shared := []models.ACLEntry{
+		{PrincipalType: GranteeUser, PrincipalID: "bob", Permission: PermRead},
+		{PrincipalType: GranteeGroup, PrincipalID: "design", Permission: PermWrite},
+	}
+	parent := []models.Folder{{Path: "team", OwnerID: "alice"}}
+
+	tests := []struct {
+		name     string
+		required bool // AUTH_REQUIRED
+		access   access
+		p        *Principal
+		perm     string
+		want     bool
+	}{
+		{name: "owner", required: true, access: access{owner: "alice"}, p: alice, perm: PermShare, want: true},
+		{name: "stranger", required: true, access: access{owner: "alice"}, p: bob, perm: PermRead},
+		{name: "admin", required: true, access: access{owner: "alice"}, p: admin, perm: PermDelete, want: true},
+		{name: "anonymous", required: true, access: access{owner: "alice"}, perm: PermRead},
+		{name: "user grant", required: true, access: access{owner: "alice", entries: shared}, p: bob, perm: PermRead, want: true},
+		{name: "user grant of another permission", required: true, access: access{owner: "alice", entries: shared}, p: bob, perm: PermDelete},
+		{name: "group grant", required: true, access: access{owner: "alice", entries: shared}, p: bob, perm: PermWrite, want: true},
+		{name: "group grant to another group", required: true, access: access{owner: "bob", entries: shared}, p: alice, perm: PermWrite},
+		{
+			name:     "public grant to anonymous callers",
+			required: true,
+			access:   access{owner: "alice", entries: []models.ACLEntry{{PrincipalType: GranteePublic, Permission: PermRead}}},
+			perm:     PermRead,
+			want:     true,
+		},
+		{name: "owner of an enclosing folder", required: true, access: access{owner: "bob", ancestors: parent}, p: alice, perm: PermDelete, want: true},
+		{name: "ownerless with auth required", required: true, access: access{}, p: alice, perm: PermRead},
+		{name: "ownerless for an admin", required: true, access: access{}, p: admin, perm: PermShare, want: true},
+		{name: "ownerless without auth", access: access{}, perm: PermWrite, want: true},
+		{name: "owned without auth", access: access{owner: "alice"}, perm: PermRead},
+		{name: "private ownerless without auth for anonymous callers", access: access{private: true}, perm: PermRead},
+		{name: "private ownerless without auth for a principal", access: access{private: true}, p: bob, perm: PermRead, want: true},
+		{
+			name:   "private with a public grant without auth",
+			access: access{private: true, entries: []models.ACLEntry{{PrincipalType: GranteePublic, Permission: PermRead}}},
+			perm:   PermRead,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.required {
+				t.Setenv("AUTH_REQUIRED", "true")
+			} else {
+				t.Setenv("AUTH_REQUIRED", "false")
+			}
+			if got := tt.access.allows(tt.p, tt.perm); got != tt.want {
+				t.Errorf("allows(%s) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessOwns(t *testing.T) {
+	tests := []struct {
+		name   string
+		access access
+		p      *Principal
+		want   bool
+	}{
+		{name: "owner", access: access{owner: "alice"}, p: &Principal{Subject: "alice"}, want: true},
+		{name: "another subject", access: access{owner: "alice"}, p: &Principal{Subject: "bob"}},
+		{name: "anonymous", access: access{owner: "alice"}},
+		{name: "empty subject on an ownerless resource", access: access{}, p: &Principal{}},
+		{name: "admin", access: access{owner: "alice"}, p: &Principal{Scopes: []string{ScopeAdmin}}, want: true},
+		{
+			name:   "owner of an enclosing folder",
+			access: access{owner: "bob", ancestors: []models.Folder{{Path: "a"}, {Path: "a/b", OwnerID: "alice"}}},
+			p:      &Principal{Subject: "alice"},
+			want:   true,
+		},
+		{
+			name:   "ownerless enclosing folder",
+			access: access{owner: "bob", ancestors: []models.Folder{{Path: "a"}}},
+			p:      &Principal{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.access.owns(tt.p); got != tt.want {
+				t.Errorf("owns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACLEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		grants  []Grant
+		want    []models.ACLEntry
+		wantErr bool
+	}{
+		{
+			name:   "one entry per permission",
+			grants: []Grant{{Type: GranteeUser, ID: " bob ", Permissions: []string{PermRead, PermWrite}}},
+			want: []models.ACLEntry{
+				{PrincipalType: GranteeUser, PrincipalID: "bob", Permission: PermRead},
+				{PrincipalType: GranteeUser, PrincipalID: "bob", Permission: PermWrite},
+			},
+		},
+		{
+			name: "duplicates merged",
+			grants: []Grant{
+				{Type: GranteeGroup, ID: "design", Permissions: []string{PermRead}},
+				{Type: GranteeGroup, ID: "design", Permissions: []string{PermRead}},
+			},
+			want: []models.ACLEntry{{PrincipalType: GranteeGroup, PrincipalID: "design", Permission: PermRead}},
+		},
+		{
+			name:   "public",
+			grants: []Grant{{Type: GranteePublic, Permissions: []string{PermRead}}},
+			want:   []models.ACLEntry{{PrincipalType: GranteePublic, Permission: PermRead}},
+		},
+		{name: "public with an id", grants: []Grant{{Type: GranteePublic, ID: "bob", Permissions: []string{PermRead}}}, wantErr: true},
+		{name: "user without an id", grants: []Grant{{Type: GranteeUser, Permissions: []string{PermRead}}}, wantErr: true},
+		{name: "unknown grantee", grants: []Grant{{Type: "role", ID: "x", Permissions: []string{PermRead}}}, wantErr: true},
+		{name: "unknown permission", grants: []Grant{{Type: GranteeUser, ID: "bob", Permissions: []string{"own"}}}, wantErr: true},
+		{name: "none", grants: []Grant{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := aclEntries(tt.grants)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidACL) {
+					t.Fatalf("aclEntries() error = %v, want %v", err, ErrInvalidACL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("aclEntries() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("aclEntries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAncestorPaths(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "", want: nil},
+		{path: "photos", want: []string{"photos"}},
+		{path: "photos/2024/june", want: []string{"photos/2024/june", "photos/2024", "photos"}},
+	}
+	for _, tt := range tests {
+		if got := ancestorPaths(tt.path); !slices.Equal(got, tt.want) {
+			t.Errorf("ancestorPaths(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"my-project/models"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scopes granted to API keys. ScopeAdmin grants every scope and the
+// management of keys.
+const (
+	ScopeFilesRead   = "files:read"
+	ScopeFilesWrite  = "files:write"
+	ScopeFilesDelete = "files:delete"
+	ScopeAdmin       = "admin"
+)
+
+// Scopes lists every scope an API key may be granted
+var Scopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeFilesDelete, ScopeAdmin}
+
+// apiKeyPrefix starts every key so leaked keys are easy to recognize
+const apiKeyPrefix = "fsk_"
+
+// lastUsedInterval limits how often the last use of a key is written
+const lastUsedInterval = time.Minute
+
+// Errors returned when managing or checking API keys
+var (
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+	ErrInvalidScope   = errors.New("invalid scope")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// hashSecret hashes the secret part of a key. Secrets are random, so a fast
+// hash is enough to protect them at rest.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey mints a key acting for tenant with the given scopes, expiring
+// after ttl unless it is 0. The returned token is the only copy of the full key.
+func CreateAPIKey(tenant, name string, scopes []string, ttl time.Duration) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, "", errors.New("name must be between 1 and 100 characters")
+	}
+	if err := CheckTenant(tenant); err != nil {
+		return nil, "", err
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, "", fmt.Errorf("%w: %q, expected one of %s", ErrInvalidScope, scope, strings.Join(Scopes, ", "))
+		}
+	}
+
+	public := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(public); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+
+	key := models.APIKey{
+		Tenant:     tenant,
+		Name:       name,
+		Prefix:     hex.EncodeToString(public),
+		SecretHash: hashSecret(encoded),
+		Scopes:     strings.Join(slices.Compact(slices.Sorted(slices.Values(scopes))), " "),
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		key.ExpiresAt = &expires
+	}
+	if err := models.DB.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+	return &key, apiKeyPrefix + key.Prefix + "." + encoded, nil
+}
+
+// ListAPIKeys returns every key of tenant, newest first
+func ListAPIKeys(tenant string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := models.DB.Where("tenant = ?", tenant).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey disables a key of tenant for good
+func RevokeAPIKey(tenant string, id uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := models.DB.Where("tenant = ?", tenant).First(&key, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := models.DB.Model(&key).UpdateColumn("revoked_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// AuthenticateAPIKey resolves a token to its key, recording when it was last used
+func AuthenticateAPIKey(token string) (*models.APIKey, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(token, apiKeyPrefix), ".")
+	if !ok || !strings.HasPrefix(token, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := models.DB.Where("prefix = ?", prefix).First(&key).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		key.LastUsedAt = &now
+		if err := models.DB.Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// KeyScopes lists the scopes granted to a key
+func KeyScopes(key *models.APIKey) []string {
+	return strings.Fields(key.Scopes)
+}
+
+// APIKeyResponse prepares the response describing a key, without its secret
+func APIKeyResponse(key *models.APIKey) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           key.ID,
+		"name":         key.Name,
+		"tenant":       key.Tenant,
+		"prefix":       apiKeyPrefix + key.Prefix,
+		"scopes":       KeyScopes(key),
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+		"revoked_at":   key.RevokedAt,
+		"created_at":   key.CreatedAt,
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"my-project/models"
+	"my-project/storage"
+	"path"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Key prefixes used for staged uploads and content-addressed blobs
+const (
+	stagingPrefix = "staging"
+	blobPrefix    = "blobs"
+)
+
+// blobKey shards the blobs of a tenant by the first bytes of their hash to
+// keep directories small
+func blobKey(tenant, hash string) string {
+	return tenantKey(tenant, path.Join(blobPrefix, hash[0:2], hash[2:4], hash))
+}
+
+// stagedBlob is an upload written to the staging area whose hash is known
+type stagedBlob struct {
+	Tenant string
+	Disk   string
+	Key    string // current location of the bytes, the blob key once moved
+	Hash   string
+	Size   int64
+
+	moved  bool // the staged object was moved to its content-addressed key
+	shared bool // the content already existed and the blob was reused
+}
+
+// stageBlob streams r to a staging key of tenant on the default disk while
+// computing its SHA-256
+func stageBlob(ctx context.Context, tenant string, r io.Reader, size int64, mimeType string) (*stagedBlob, error) {
+	store, err := storage.Default()
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	counter := &countingReader{r: io.TeeReader(r, hasher)}
+	key := tenantKey(tenant, path.Join(stagingPrefix, uuid.New().String()))
+
+	if err := store.Put(ctx, key, counter, size, mimeType); err != nil {
+		store.Delete(context.Background(), key)
+		return nil, err
+	}
+	if size >= 0 && counter.n != size {
+		store.Delete(context.Background(), key)
+		return nil, errors.New("uploaded size does not match the declared size")
+	}
+
+	return &stagedBlob{
+		Tenant: tenant,
+		Disk:   storage.DefaultName(),
+		Key:    key,
+		Hash:   hex.EncodeToString(hasher.Sum(nil)),
+		Size:   counter.n,
+	}, nil
+}
+
+// finish drops the staged copy once its content has been linked to an existing blob
+func (s *stagedBlob) finish() {
+	if s.shared && !s.moved {
+		s.delete()
+	}
+}
+
+// abort removes whatever this upload wrote when the surrounding transaction failed.
+// An object moved onto a key another upload also references is left in place.
+func (s *stagedBlob) abort() {
+	if !s.moved || !s.shared {
+		s.delete()
+	}
+}
+
+func (s *stagedBlob) delete() {
+	if store, err := storage.Disk(s.Disk); err == nil {
+		store.Delete(context.Background(), s.Key)
+	}
+}
+
+// commitBlob turns a staged upload into a referenced blob inside tx. When a
+// blob of the tenant with the same hash exists its reference count is incremented
+// and the staged copy is dropped by finish, otherwise the staged object is
+// moved to its content-addressed key.
+func commitBlob(ctx context.Context, tx *gorm.DB, staged *stagedBlob) (*models.Blob, error) {
+	var blob models.Blob
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("tenant = ? AND hash = ?", staged.Tenant, staged.Hash).Limit(1).Find(&blob)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		staged.shared = true
+		return &blob, incrementBlob(tx, &blob)
+	}
+
+	store, err := storage.Disk(staged.Disk)
+	if err != nil {
+		return nil, err
+	}
+	key := blobKey(staged.Tenant, staged.Hash)
+	if err := store.Move(ctx, staged.Key, key); err != nil {
+		return nil, err
+	}
+	staged.Key = key
+	staged.moved = true
+
+	blob = models.Blob{
+		Tenant:   staged.Tenant,
+		Hash:     staged.Hash,
+		Disk:     staged.Disk,
+		Path:     key,
+		Size:     staged.Size,
+		RefCount: 1,
+	}
+	result = tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "tenant"}, {Name: "hash"}}, DoNothing: true}).Create(&blob)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// A concurrent upload of the same content won the insert; share its blob
+		staged.shared = true
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("tenant = ? AND hash = ?", staged.Tenant, staged.Hash).First(&blob).Error; err != nil {
+			return nil, err
+		}
+		return &blob, incrementBlob(tx, &blob)
+	}
+	return &blob, nil
+}
+
+// incrementBlob adds a reference to an existing blob
+func incrementBlob(tx *gorm.DB, blob *models.Blob) error {
+	if err := tx.Model(blob).UpdateColumn("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+		return err
+	}
+	blob.RefCount++
+	return nil
+}
+
+// releaseBlob drops one reference to the blob inside tx. It returns the blob
+// when this was the last reference so the caller can delete the physical
+// object once the transaction has committed.
+func releaseBlob(tx *gorm.DB, blobID uint) (*models.Blob, error) {
+	var blob models.Blob
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, blobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if blob.RefCount > 1 {
+		return nil, tx.Model(&blob).UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error
+	}
+	if err := tx.Delete(&blob).Error; err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// deleteBlobObject removes the physical object of an unreferenced blob and its cached derivatives
+func deleteBlobObject(ctx context.Context, blob *models.Blob) error {
+	if blob == nil {
+		return nil
+	}
+	store, err := storage.Disk(blob.Disk)
+	if err != nil {
+		return err
+	}
+	if err := deleteDerivatives(ctx, store, blob.Tenant, blob.Hash); err != nil {
+		return err
+	}
+	return store.Delete(ctx, blob.Path)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
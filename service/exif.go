@@ -0,0 +1,326 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"my-project/config"
+	"strings"
+	"time"
+)
+
+// reencodeQuality is the JPEG quality used when a photo has to be rotated
+const reencodeQuality = 92
+
+// exifInfo holds the EXIF fields the service understands
+type exifInfo struct {
+	Orientation int
+	Make        string
+	Model       string
+	TakenAt     string // DateTimeOriginal as "2006:01:02 15:04:05"
+}
+
+// EXIF tags read from the TIFF structure
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+// sanitizeImage removes embedded metadata such as EXIF, GPS, XMP and text
+// chunks from a JPEG or PNG, rotating JPEG photos to their EXIF orientation.
+// It returns the cleaned content and the EXIF fields found in the original.
+func sanitizeImage(content []byte, mimeType string) ([]byte, *exifInfo, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return sanitizeJPEG(content)
+	case "image/png":
+		cleaned, err := stripPNG(content)
+		return cleaned, nil, err
+	}
+	return content, nil, nil
+}
+
+// canSanitize reports whether sanitizeImage handles a content type
+func canSanitize(mimeType string) bool {
+	return mimeType == "image/jpeg" || mimeType == "image/png"
+}
+
+// sanitizeJPEG drops metadata segments and anything after the end of the
+// image, or re-encodes the photo upright when its orientation is not the
+// default. The encoder writes no metadata.
+func sanitizeJPEG(content []byte) ([]byte, *exifInfo, error) {
+	var info *exifInfo
+	var cleaned bytes.Buffer
+	cleaned.Write(content[:2])
+
+	pos := 2
+	if len(content) < 4 || content[0] != 0xFF || content[1] != 0xD8 {
+		return nil, nil, ErrImageUnreadable
+	}
+	for pos+2 <= len(content) {
+		if content[pos] != 0xFF {
+			return nil, nil, ErrImageUnreadable
+		}
+		marker := content[pos+1]
+		if marker == 0xFF {
+			pos++ // fill byte
+			continue
+		}
+		if marker == 0xD9 {
+			// End of image: trailers and appended images such as MPF previews are dropped
+			cleaned.Write(content[pos : pos+2])
+			break
+		}
+		if pos+4 > len(content) {
+			return nil, nil, ErrImageUnreadable
+		}
+		length := int(binary.BigEndian.Uint16(content[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(content) {
+			return nil, nil, ErrImageUnreadable
+		}
+		segment := content[pos+4 : end]
+
+		switch {
+		case marker == 0xDA:
+			// Start of scan: the compressed data is kept up to the next marker
+			end = scanEnd(content, end)
+			cleaned.Write(content[pos:end])
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			if info == nil {
+				info = parseExif(segment[6:])
+			}
+		case marker == 0xE2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")):
+			cleaned.Write(content[pos:end])
+		case marker == 0xE1, marker >= 0xE2 && marker <= 0xED, marker == 0xEF, marker == 0xFE:
+			// XMP, FlashPix, MPF, IPTC, vendor segments and comments
+		default:
+			// JFIF, Adobe color transforms and the frame itself
+			cleaned.Write(content[pos:end])
+		}
+		pos = end
+	}
+
+	if info == nil || info.Orientation <= 1 || info.Orientation > 8 {
+		return cleaned.Bytes(), info, nil
+	}
+
+	// Rotating decodes the whole photo, so its size is checked from the header first
+	header, err := jpeg.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, ErrImageUnreadable
+	}
+	if int64(header.Width)*int64(header.Height) > config.LoadTransformConfig().MaxPixels {
+		return nil, nil, ErrImageTooLarge
+	}
+	img, err := jpeg.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, ErrImageUnreadable
+	}
+	var upright bytes.Buffer
+	if err := jpeg.Encode(&upright, orient(img, info.Orientation), &jpeg.Options{Quality: reencodeQuality}); err != nil {
+		return nil, nil, err
+	}
+	return upright.Bytes(), info, nil
+}
+
+// scanEnd returns the offset of the first marker after the entropy coded
+// data starting at pos, skipping stuffed bytes and restart markers. Data cut
+// short runs to the end of content.
+func scanEnd(content []byte, pos int) int {
+	for ; pos+1 < len(content); pos++ {
+		if content[pos] != 0xFF {
+			continue
+		}
+		next := content[pos+1]
+		if next != 0x00 && next != 0xFF && (next < 0xD0 || next > 0xD7) {
+			return pos
+		}
+	}
+	return len(content)
+}
+
+// orient rotates and flips img so that EXIF orientation o displays upright
+func orient(img image.Image, o int) image.Image {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
+
+// parseExif reads the orientation, camera and capture time from a TIFF
+// structure. Malformed data yields whatever could be read before the error.
+func parseExif(tiff []byte) *exifInfo {
+	info := &exifInfo{}
+	if len(tiff) < 8 {
+		return info
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return info
+	}
+
+	exifOffset := 0
+	readIFD(tiff, order, int(order.Uint32(tiff[4:8])), func(tag uint16, kind uint16, count uint32, value []byte) {
+		switch tag {
+		case tagOrientation:
+			if kind == 3 {
+				info.Orientation = int(order.Uint16(value))
+			}
+		case tagMake:
+			info.Make = exifString(tiff, order, kind, count, value)
+		case tagModel:
+			info.Model = exifString(tiff, order, kind, count, value)
+		case tagExifIFD:
+			exifOffset = int(order.Uint32(value))
+		}
+	})
+	if exifOffset > 0 {
+		readIFD(tiff, order, exifOffset, func(tag uint16, kind uint16, count uint32, value []byte) {
+			if tag == tagDateTimeOriginal {
+				info.TakenAt = exifString(tiff, order, kind, count, value)
+			}
+		})
+	}
+	return info
+}
+
+// readIFD calls fn with the raw 4 byte value field of every entry of the IFD at offset
+func readIFD(tiff []byte, order binary.ByteOrder, offset int, fn func(tag, kind uint16, count uint32, value []byte)) {
+	if offset < 8 || offset+2 > len(tiff) {
+		return
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return
+		}
+		fn(order.Uint16(tiff[entry:]), order.Uint16(tiff[entry+2:]), order.Uint32(tiff[entry+4:]), tiff[entry+8:entry+12])
+	}
+}
+
+// exifString reads an ASCII value, stored inline when it fits in four bytes
+func exifString(tiff []byte, order binary.ByteOrder, kind uint16, count uint32, value []byte) string {
+	if kind != 2 {
+		return ""
+	}
+	data := value
+	if count > 4 {
+		offset := int(order.Uint32(value))
+		if offset < 0 || offset+int(count) > len(tiff) {
+			return ""
+		}
+		data = tiff[offset : offset+int(count)]
+	} else if int(count) < len(data) {
+		data = data[:count]
+	}
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// strippedPNGChunks carry text, timestamps or EXIF data
+var strippedPNGChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPNG drops the metadata chunks of a PNG without touching the image data
+func stripPNG(content []byte) ([]byte, error) {
+	if !bytes.HasPrefix(content, pngSignature) {
+		return nil, ErrImageUnreadable
+	}
+	var cleaned bytes.Buffer
+	cleaned.Write(pngSignature)
+	pos := len(pngSignature)
+	for pos+12 <= len(content) {
+		length := int(binary.BigEndian.Uint32(content[pos:]))
+		end := pos + 12 + length
+		if end > len(content) {
+			return nil, ErrImageUnreadable
+		}
+		chunkType := string(content[pos+4 : pos+8])
+		if !strippedPNGChunks[chunkType] {
+			cleaned.Write(content[pos:end])
+		}
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return cleaned.Bytes(), nil
+}
+
+// exifMetadata renders the requested EXIF fields as "exif.<field>" metadata.
+// Supported fields are "camera" and "taken_at".
+func exifMetadata(info *exifInfo, fields []string) map[string]string {
+	metadata := map[string]string{}
+	if info == nil {
+		return metadata
+	}
+	for _, field := range fields {
+		switch field {
+		case "camera":
+			camera := info.Model
+			if info.Make != "" && !strings.HasPrefix(strings.ToLower(info.Model), strings.ToLower(info.Make)) {
+				camera = strings.TrimSpace(info.Make + " " + info.Model)
+			}
+			if camera != "" {
+				metadata["exif.camera"] = truncate(camera, maxMetaValueLen)
+			}
+		case "taken_at":
+			if takenAt, err := time.Parse("2006:01:02 15:04:05", info.TakenAt); err == nil {
+				metadata["exif.taken_at"] = takenAt.Format("2006-01-02T15:04:05")
+			}
+		}
+	}
+	return metadata
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
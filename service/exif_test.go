@@ -0,0 +1,54 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegSegment encodes an APPn or COM segment
+func jpegSegment(marker byte, payload string) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+len(payload)))
+	return append(segment, payload...)
+}
+
+func TestSanitizeJPEG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+	photo := encoded.Bytes()
+	content := bytes.Join([][]byte{
+		photo[:2],
+		jpegSegment(0xE1, "Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x00"),
+		jpegSegment(0xE2, "ICC_PROFILE\x00\x01\x01profile"),
+		jpegSegment(0xE2, "MPF\x00secondary image index"),
+		jpegSegment(0xE2, "FPXR\x00flashpix"),
+		jpegSegment(0xFE, "a comment"),
+		photo[2:],
+		[]byte("trailing data"),
+		photo, // an appended preview, as MPF files carry
+	}, nil)
+
+	cleaned, _, err := sanitizeJPEG(content)
+	if err != nil {
+		t.Fatalf("sanitizeJPEG() error = %v", err)
+	}
+	if !bytes.Contains(cleaned, []byte("ICC_PROFILE\x00")) {
+		t.Error("ICC profile dropped")
+	}
+	for _, removed := range []string{"Exif", "MPF", "FPXR", "a comment", "trailing data"} {
+		if bytes.Contains(cleaned, []byte(removed)) {
+			t.Errorf("%q kept", removed)
+		}
+	}
+	if want := len(photo) + len(jpegSegment(0xE2, "ICC_PROFILE\x00\x01\x01profile")); len(cleaned) != want {
+		t.Errorf("cleaned %d bytes, want %d ending at the first end of image", len(cleaned), want)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(cleaned)); err != nil {
+		t.Errorf("cleaned image does not decode: %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"my-project/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxFolderPath matches the size of the folder path columns
+const maxFolderPath = 255
+
+// Errors returned by folder operations
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderExists   = errors.New("a folder with this name already exists")
+	ErrInvalidFolder  = errors.New("invalid folder name")
+	ErrFolderCycle    = errors.New("a folder cannot be moved into itself")
+)
+
+// folderConflict skips inserting a folder whose path its tenant already has
+var folderConflict = clause.OnConflict{Columns: []clause.Column{{Name: "tenant"}, {Name: "path"}}, DoNothing: true}
+
+// checkFolderName validates the name of a single folder
+func checkFolderName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidFolder, name)
+	}
+	return nil
+}
+
+// checkFolderPath validates a cleaned folder path
+func checkFolderPath(folderPath string) error {
+	if len(folderPath) > maxFolderPath {
+		return fmt.Errorf("%w: path is longer than %d characters", ErrInvalidFolder, maxFolderPath)
+	}
+	return nil
+}
+
+// UploadFolder returns the cleaned path of the folder an upload of tenant is
+// stored in: the folder with id folderID when set, folderPath otherwise. Both
+// may be given when they name the same folder.
+func UploadFolder(tenant string, folderID *uint, folderPath string) (string, error) {
+	folderPath = CleanFolder(folderPath)
+	if folderID == nil {
+		return folderPath, checkFolderPath(folderPath)
+	}
+	folder, err := findFolder(models.DB, tenant, *folderID)
+	if err != nil {
+		return "", err
+	}
+	if folderPath != "" && folderPath != folder.Path {
+		return "", fmt.Errorf("%w: folder %q is not folder %d", ErrInvalidFolder, folderPath, *folderID)
+	}
+	return folder.Path, nil
+}
+
+// findFolder loads a folder of tenant by id inside tx
+func findFolder(tx *gorm.DB, tenant string, id uint) (*models.Folder, error) {
+	var folder models.Folder
+	err := tx.Where("tenant = ?", tenant).First(&folder, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFolderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// findParent loads the folder a child is created or moved into, nil meaning the root
+func findParent(tx *gorm.DB, tenant string, parentID *uint) (*models.Folder, error) {
+	if parentID == nil || *parentID == 0 {
+		return nil, nil
+	}
+	return findFolder(tx, tenant, *parentID)
+}
+
+// childPath joins the path of a parent folder and a name
+func childPath(parent *models.Folder, name string) string {
+	if parent == nil {
+		return name
+	}
+	return parent.Path + "/" + name
+}
+
+// folderID returns the id of a folder, nil for the root
+func folderID(folder *models.Folder) *uint {
+	if folder == nil {
+		return nil
+	}
+	return &folder.ID
+}
+
+// ensureFolder returns the folder of tenant at a cleaned path, creating it and
+// any missing ancestor owned by the subject owner. The empty path is the root
+// and yields nil.
+func ensureFolder(tx *gorm.DB, tenant, folderPath, owner string) (*models.Folder, error) {
+	if folderPath == "" {
+		return nil, nil
+	}
+	if err := checkFolderPath(folderPath); err != nil {
+		return nil, err
+	}
+
+	var parent *models.Folder
+	for _, name := range strings.Split(folderPath, "/") {
+		folder := models.Folder{Tenant: tenant, Name: name, ParentID: folderID(parent), Path: childPath(parent, name), OwnerID: owner}
+		result := tx.Where("tenant = ? AND path = ?", tenant, folder.Path).Limit(1).Find(&folder)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// A concurrent upload may create the same folder; keep whichever row won
+			result = tx.Clauses(folderConflict).Create(&folder)
+			if result.Error != nil {
+				return nil, result.Error
+			}
+			if result.RowsAffected == 0 {
+				if err := tx.Where("tenant = ? AND path = ?", tenant, folder.Path).First(&folder).Error; err != nil {
+					return nil, err
+				}
+			}
+		}
+		parent = &folder
+	}
+	return parent, nil
+}
+
+// CreateFolder creates a folder of tenant named name inside parentID, nil for
+// the root, owned by the subject owner
+func CreateFolder(tenant, name string, parentID *uint, owner string) (*models.Folder, error) {
+	if err := checkFolderName(name); err != nil {
+		return nil, err
+	}
+
+	var folder *models.Folder
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		parent, err := findParent(tx, tenant, parentID)
+		if err != nil {
+			return err
+		}
+		folder = &models.Folder{Tenant: tenant, Name: name, ParentID: folderID(parent), Path: childPath(parent, name), OwnerID: owner}
+		if err := checkFolderPath(folder.Path); err != nil {
+			return err
+		}
+		result := tx.Clauses(folderConflict).Create(folder)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrFolderExists
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// GetFolder returns a folder of tenant by id
+func GetFolder(tenant string, id uint) (*models.Folder, error) {
+	return findFolder(models.DB, tenant, id)
+}
+
+// ListFolders returns the child folders of parentID, nil for the root of
+// tenant, sorted by name
+func ListFolders(tenant string, parentID *uint) ([]models.Folder, error) {
+	db := models.DB.Where("tenant = ?", tenant).Order("name ASC, id ASC")
+	if parentID == nil {
+		db = db.Where("parent_id IS NULL")
+	} else {
+		db = db.Where("parent_id = ?", *parentID)
+	}
+	var folders []models.Folder
+	err := db.Find(&folders).Error
+	return folders, err
+}
+
+// descendants returns a folder and every folder below it
+func descendants(tx *gorm.DB, folder *models.Folder) ([]models.Folder, error) {
+	var folders []models.Folder
+	err := tx.Where("tenant = ? AND (path = ? OR path LIKE ?)", folder.Tenant, folder.Path, escapeLike(folder.Path)+"/%").Find(&folders).Error
+	return folders, err
+}
+
+// relocateFolder gives a folder a new parent and name, rewriting the paths of
+// its subtree and of the files it contains
+func relocateFolder(tx *gorm.DB, folder *models.Folder, parent *models.Folder, name string) error {
+	newPath := childPath(parent, name)
+	if newPath == folder.Path {
+		return nil
+	}
+	if parent != nil && (parent.Path == folder.Path || strings.HasPrefix(parent.Path, folder.Path+"/")) {
+		return ErrFolderCycle
+	}
+
+	var existing int64
+	if err := tx.Model(&models.Folder{}).Where("tenant = ? AND path = ?", folder.Tenant, newPath).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return ErrFolderExists
+	}
+
+	subtree, err := descendants(tx, folder)
+	if err != nil {
+		return err
+	}
+	for _, node := range subtree {
+		nodePath := newPath + strings.TrimPrefix(node.Path, folder.Path)
+		if err := checkFolderPath(nodePath); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Folder{}).Where("id = ?", node.ID).UpdateColumn("path", nodePath).Error; err != nil {
+			return err
+		}
+		// Trashed files move along so they are restored into the renamed folder
+		err := tx.Unscoped().Model(&models.File{}).Where("folder_id = ?", node.ID).UpdateColumn("folder", nodePath).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	folder.Name = name
+	folder.ParentID = folderID(parent)
+	folder.Path = newPath
+	return tx.Model(folder).Updates(map[string]interface{}{"name": name, "parent_id": folder.ParentID}).Error
+}
+
+// RenameFolder changes the name of a folder of tenant
+func RenameFolder(tenant string, id uint, name string) (*models.Folder, error) {
+	if err := checkFolderName(name); err != nil {
+		return nil, err
+	}
+
+	var folder *models.Folder
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if folder, err = findFolder(tx.Clauses(clause.Locking{Strength: "UPDATE"}), tenant, id); err != nil {
+			return err
+		}
+		parent, err := findParent(tx, tenant, folder.ParentID)
+		if err != nil {
+			return err
+		}
+		return relocateFolder(tx, folder, parent, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// MoveFolder moves a folder of tenant with its content into parentID, nil for the root
+func MoveFolder(tenant string, id uint, parentID *uint) (*models.Folder, error) {
+	var folder *models.Folder
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if folder, err = findFolder(tx.Clauses(clause.Locking{Strength: "UPDATE"}), tenant, id); err != nil {
+			return err
+		}
+		parent, err := findParent(tx, tenant, parentID)
+		if err != nil {
+			return err
+		}
+		return relocateFolder(tx, folder, parent, folder.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// DeleteFolder removes a folder of tenant and its subfolders. The files they
+// contain are moved to the trash and return to a recreated folder when restored.
+func DeleteFolder(tenant string, id uint) (int64, error) {
+	var trashed int64
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		folder, err := findFolder(tx.Clauses(clause.Locking{Strength: "UPDATE"}), tenant, id)
+		if err != nil {
+			return err
+		}
+		subtree, err := descendants(tx, folder)
+		if err != nil {
+			return err
+		}
+		ids := make([]uint, 0, len(subtree))
+		for _, node := range subtree {
+			ids = append(ids, node.ID)
+		}
+
+		result := tx.Where("folder_id IN ?", ids).Delete(&models.File{})
+		if result.Error != nil {
+			return result.Error
+		}
+		trashed = result.RowsAffected
+
+		// Trashed files keep their folder path but no longer point at a row
+		err = tx.Unscoped().Model(&models.File{}).Where("folder_id IN ?", ids).UpdateColumn("folder_id", nil).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("folder_id IN ?", ids).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Folder{}).Where("id IN ?", ids).UpdateColumn("parent_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.Folder{}).Error
+	})
+	return trashed, err
+}
+
+// MoveFile moves a live file of tenant into folderID, nil for the root
+func MoveFile(tenant, filename string, folderID *uint) (*models.File, error) {
+	var file *models.File
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if file, err = lockFile(tx, tenant, filename); err != nil {
+			return err
+		}
+		folder, err := findParent(tx, tenant, folderID)
+		if err != nil {
+			return err
+		}
+		file.FolderID, file.Folder = nil, ""
+		if folder != nil {
+			file.FolderID = &folder.ID
+			file.Folder = folder.Path
+		}
+		// Preset derivatives follow their original
+		return tx.Model(&models.File{}).Where("id = ? OR parent_id = ?", file.ID, file.ID).
+			UpdateColumns(map[string]interface{}{"folder_id": file.FolderID, "folder": file.Folder}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// SyncFolders creates the folder rows of files uploaded before folders were
+// tracked and links those files to them. Trashed files are left out, they
+// recreate their folder when restored.
+func SyncFolders() error {
+	var paths []struct {
+		Tenant string
+		Folder string
+	}
+	err := models.DB.Model(&models.File{}).Select("tenant", "folder").
+		Where("folder_id IS NULL AND folder <> ''").Distinct().Find(&paths).Error
+	if err != nil {
+		return err
+	}
+
+	for _, unsynced := range paths {
+		err := models.DB.Transaction(func(tx *gorm.DB) error {
+			folder, err := ensureFolder(tx, unsynced.Tenant, CleanFolder(unsynced.Folder), "")
+			if err != nil || folder == nil {
+				return err
+			}
+			return tx.Model(&models.File{}).Where("folder_id IS NULL AND tenant = ? AND folder = ?", unsynced.Tenant, unsynced.Folder).
+				UpdateColumn("folder_id", folder.ID).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
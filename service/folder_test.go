@@ -0,0 +1,47 @@
+package service
+
+import (
+	"errors"
+	"my-project/models"
+	"strings"
+	"testing"
+)
+
+func TestUploadFolder(t *testing.T) {
+	testDB(t)
+	folder, err := ensureFolder(models.DB, "acme", "Photos/Summer 2024", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := folder.ID + 1
+
+	tests := []struct {
+		name     string
+		tenant   string
+		folderID *uint
+		path     string
+		want     string
+		err      error
+	}{
+		{name: "root"},
+		{name: "path kept as named", path: "/Photos//Summer 2024/", want: "Photos/Summer 2024"},
+		{name: "parent segments dropped", path: "../a/../b", want: "b"},
+		{name: "path too long", path: strings.Repeat("a", maxFolderPath+1), err: ErrInvalidFolder},
+		{name: "id", tenant: "acme", folderID: &folder.ID, want: "Photos/Summer 2024"},
+		{name: "id with its path", tenant: "acme", folderID: &folder.ID, path: "Photos/Summer 2024/", want: "Photos/Summer 2024"},
+		{name: "id with another path", tenant: "acme", folderID: &folder.ID, path: "photos", err: ErrInvalidFolder},
+		{name: "id of another tenant", tenant: "globex", folderID: &folder.ID, err: ErrFolderNotFound},
+		{name: "unknown id", tenant: "acme", folderID: &other, err: ErrFolderNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UploadFolder(tt.tenant, tt.folderID, tt.path)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("UploadFolder() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("UploadFolder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"my-project/config"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for bearer tokens that fail verification
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// jwtMethods are the signing algorithms accepted for bearer tokens
+var jwtMethods = []string{"HS256", "RS256", "ES256"}
+
+// jwtKey is a verification key with the "kid" it is published under
+type jwtKey struct {
+	ID  string
+	Key interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// The configured keys are read once, restart the service to rotate them
+var (
+	jwtKeysOnce sync.Once
+	jwtKeys     []jwtKey
+	jwtKeysErr  error
+)
+
+// loadJWTKeys reads every verification key from the configuration
+func loadJWTKeys(cfg config.JWTConfig) ([]jwtKey, error) {
+	var keys []jwtKey
+	if cfg.Secret != "" {
+		keys = append(keys, jwtKey{Key: []byte(cfg.Secret)})
+	}
+	if cfg.PublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			keys = append(keys, jwtKey{Key: key})
+		} else if key, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+			keys = append(keys, jwtKey{Key: key})
+		} else {
+			return nil, fmt.Errorf("%s: not an RSA or EC public key", cfg.PublicKeyFile)
+		}
+	}
+	if cfg.JWKSFile != "" {
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		set, err := parseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.JWKSFile, err)
+		}
+		keys = append(keys, set...)
+	}
+	return keys, nil
+}
+
+// parseJWKS decodes the RSA, P-256 and symmetric keys of a JSON Web Key Set.
+// Keys meant for encryption or other algorithms are skipped.
+func parseJWKS(data []byte) ([]jwtKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []jwtKey
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch {
+		case jwk.Kty == "RSA" && (jwk.Alg == "" || jwk.Alg == "RS256"):
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				return nil, fmt.Errorf("invalid RSA key %q", jwk.Kid)
+			}
+			key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			keys = append(keys, jwtKey{ID: jwk.Kid, Key: key})
+		case jwk.Kty == "EC" && jwk.Crv == "P-256" && (jwk.Alg == "" || jwk.Alg == "ES256"):
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if errX != nil || errY != nil || !key.Curve.IsOnCurve(key.X, key.Y) {
+				return nil, fmt.Errorf("invalid EC key %q", jwk.Kid)
+			}
+			keys = append(keys, jwtKey{ID: jwk.Kid, Key: key})
+		case jwk.Kty == "oct" && (jwk.Alg == "" || jwk.Alg == "HS256"):
+			secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+			if err != nil {
+				return nil, fmt.Errorf("invalid symmetric key %q", jwk.Kid)
+			}
+			keys = append(keys, jwtKey{ID: jwk.Kid, Key: secret})
+		}
+	}
+	return keys, nil
+}
+
+// verificationKeys selects the keys that may have signed token, by "kid"
+// when the token names one and by the type the algorithm requires
+func verificationKeys(keys []jwtKey) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		var set jwt.VerificationKeySet
+		for _, key := range keys {
+			if kid != "" && key.ID != "" && key.ID != kid {
+				continue
+			}
+			switch k := key.Key.(type) {
+			case []byte:
+				if token.Method.Alg() == "HS256" {
+					set.Keys = append(set.Keys, k)
+				}
+			case *rsa.PublicKey:
+				if token.Method.Alg() == "RS256" {
+					set.Keys = append(set.Keys, k)
+				}
+			case *ecdsa.PublicKey:
+				if token.Method.Alg() == "ES256" {
+					set.Keys = append(set.Keys, k)
+				}
+			}
+		}
+		if len(set.Keys) == 0 {
+			return nil, errors.New("no key matches the token")
+		}
+		return set, nil
+	}
+}
+
+// AuthenticateJWT verifies a bearer token and maps its sub, tenant, scopes and
+// groups claims to a principal
+func AuthenticateJWT(token string) (*Principal, error) {
+	cfg := config.LoadJWTConfig()
+	if !cfg.Enabled() {
+		return nil, ErrInvalidToken
+	}
+	jwtKeysOnce.Do(func() {
+		jwtKeys, jwtKeysErr = loadJWTKeys(cfg)
+	})
+	if jwtKeysErr != nil {
+		return nil, fmt.Errorf("loading JWT keys: %w", jwtKeysErr)
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, verificationKeys(jwtKeys), options...); err != nil {
+		return nil, ErrInvalidToken
+	}
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	principal := &Principal{Subject: subject}
+	principal.Tenant, _ = claims[cfg.TenantClaim].(string)
+	if CheckTenant(principal.Tenant) != nil {
+		return nil, ErrInvalidToken
+	}
+	principal.Scopes = listClaim(claims[cfg.ScopesClaim])
+	principal.Groups = listClaim(claims[cfg.GroupsClaim])
+	return principal, nil
+}
+
+// listClaim reads a claim holding a space separated string or an array of strings
+func listClaim(claim interface{}) []string {
+	var values []string
+	switch claim := claim.(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []interface{}:
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
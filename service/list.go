@@ -0,0 +1,269 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"my-project/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Pagination bounds for ListFiles
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// Errors returned for malformed listing parameters
+var (
+	ErrInvalidQuery  = errors.New("invalid query")
+	ErrInvalidCursor = fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+)
+
+// sortColumns maps the sortable fields of the API to their columns
+var sortColumns = map[string]string{
+	"filename":     "filename",
+	"originalname": "original_name",
+	"mimetype":     "mime_type",
+	"size":         "size",
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"deleted_at":   "deleted_at",
+}
+
+// FileQuery holds the filters, sorting and pagination of a file listing
+type FileQuery struct {
+	MimeType      string            `form:"mimetype"` // exact type or wildcard such as "image/*"
+	MinSize       *int64            `form:"min_size"`
+	MaxSize       *int64            `form:"max_size"`
+	CreatedAfter  string            `form:"created_after"` // RFC 3339 timestamp or date
+	CreatedBefore string            `form:"created_before"`
+	Name          string            `form:"name"` // case-insensitive substring of the original name
+	Folder        *string           `form:"folder"`
+	Tags          []string          `form:"tag"`        // files must carry every tag
+	Meta          map[string]string `form:"-"`          // metadata that must match exactly, from meta.<key> parameters
+	Sort          string            `form:"sort"`       // field name, prefixed with "-" for descending
+	Pagination    string            `form:"pagination"` // "offset" (default) or "cursor"
+	Page          int               `form:"page"`
+	PerPage       int               `form:"per_page"`
+	Cursor        string            `form:"cursor"` // implies cursor pagination
+	Limit         int               `form:"limit"`
+	Trashed       bool              `form:"-"` // list soft deleted files instead of live ones
+	Tenant        string            `form:"-"` // tenant whose files are listed
+	Viewer        *Principal        `form:"-"` // caller the listing is restricted to the readable files of, nil when anonymous
+}
+
+// FileList is a page of files together with its pagination details
+type FileList struct {
+	Files      []models.File
+	Total      int64 // only filled for offset pagination
+	Page       int   // only filled for offset pagination
+	PerPage    int
+	NextCursor string // empty on the last page
+}
+
+// fileCursor is the position after the last row of a cursor page
+type fileCursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// ListFiles returns the files matching q. Offset pagination is used unless a
+// cursor is given or pagination=cursor is requested, in which case rows are
+// paged by keyset on the sort column and id.
+func ListFiles(q FileQuery) (*FileList, error) {
+	field, desc := strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+	if q.Sort == "" {
+		field, desc = "created_at", true
+		if q.Trashed {
+			field = "deleted_at"
+		}
+	}
+	column, ok := sortColumns[field]
+	if !ok || (column == "deleted_at" && !q.Trashed) {
+		return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, field)
+	}
+
+	db := models.DB.Model(&models.File{})
+	if q.Trashed {
+		db = db.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	db, err := filterFiles(db, q)
+	if err != nil {
+		return nil, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+	order := fmt.Sprintf("%s %s, id %s", column, direction, direction)
+
+	if q.Cursor == "" && q.Pagination != "cursor" {
+		list := &FileList{Page: q.Page, PerPage: clampPerPage(q.PerPage)}
+		if list.Page < 1 {
+			list.Page = 1
+		}
+		if err := db.Count(&list.Total).Error; err != nil {
+			return nil, err
+		}
+		err := withDetails(db).Order(order).Offset((list.Page - 1) * list.PerPage).Limit(list.PerPage).Find(&list.Files).Error
+		return list, err
+	}
+
+	list := &FileList{PerPage: clampPerPage(q.Limit)}
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		value, err := cursorValue(column, cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", column, comparison, column, comparison),
+			value, value, cursor.ID)
+	}
+
+	// Fetch one extra row to know whether another page follows
+	if err := withDetails(db).Order(order).Limit(list.PerPage + 1).Find(&list.Files).Error; err != nil {
+		return nil, err
+	}
+	if len(list.Files) > list.PerPage {
+		list.Files = list.Files[:list.PerPage]
+		last := list.Files[len(list.Files)-1]
+		list.NextCursor = encodeCursor(fileCursor{Value: columnValue(column, last), ID: last.ID})
+	}
+	return list, nil
+}
+
+// filterFiles applies the filters of q to db
+func filterFiles(db *gorm.DB, q FileQuery) (*gorm.DB, error) {
+	// Preset derivatives are listed with their original
+	db = db.Where("files.tenant = ? AND files.parent_id IS NULL", q.Tenant)
+	db, err := readableFiles(db, q.Viewer, q.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if q.MimeType != "" {
+		if strings.HasSuffix(q.MimeType, "/*") {
+			db = db.Where("mime_type LIKE ?", strings.TrimSuffix(q.MimeType, "*")+"%")
+		} else {
+			db = db.Where("mime_type = ? OR mime_type LIKE ?", q.MimeType, q.MimeType+";%")
+		}
+	}
+	if q.MinSize != nil {
+		db = db.Where("size >= ?", *q.MinSize)
+	}
+	if q.MaxSize != nil {
+		db = db.Where("size <= ?", *q.MaxSize)
+	}
+	if q.CreatedAfter != "" {
+		after, err := parseTimeParam(q.CreatedAfter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: created_after must be a date or RFC 3339 timestamp", ErrInvalidQuery)
+		}
+		db = db.Where("created_at >= ?", after)
+	}
+	if q.CreatedBefore != "" {
+		before, err := parseTimeParam(q.CreatedBefore)
+		if err != nil {
+			return nil, fmt.Errorf("%w: created_before must be a date or RFC 3339 timestamp", ErrInvalidQuery)
+		}
+		db = db.Where("created_at < ?", before)
+	}
+	if q.Name != "" {
+		db = db.Where("LOWER(original_name) LIKE ?", "%"+escapeLike(strings.ToLower(q.Name))+"%")
+	}
+	if q.Folder != nil {
+		db = db.Where("folder = ?", CleanFolder(*q.Folder))
+	}
+	for _, tag := range q.Tags {
+		db = db.Where("EXISTS (SELECT 1 FROM file_tags WHERE file_tags.file_id = files.id AND file_tags.tag = ?)", strings.TrimSpace(tag))
+	}
+	for key, value := range q.Meta {
+		db = db.Where("EXISTS (SELECT 1 FROM file_metadata WHERE file_metadata.file_id = files.id AND file_metadata.meta_key = ? AND file_metadata.meta_value = ?)", key, value)
+	}
+	return db, nil
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or a plain date
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func clampPerPage(n int) int {
+	if n <= 0 {
+		return defaultPerPage
+	}
+	if n > maxPerPage {
+		return maxPerPage
+	}
+	return n
+}
+
+// columnValue renders the sort column of a row for a cursor
+func columnValue(column string, file models.File) string {
+	switch column {
+	case "filename":
+		return file.Filename
+	case "original_name":
+		return file.OriginalName
+	case "mime_type":
+		return file.MimeType
+	case "size":
+		return strconv.FormatInt(file.Size, 10)
+	case "updated_at":
+		return file.UpdatedAt.Format(time.RFC3339Nano)
+	case "deleted_at":
+		return file.DeletedAt.Time.Format(time.RFC3339Nano)
+	default:
+		return file.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+// cursorValue parses a cursor value back into the type of its column
+func cursorValue(column, value string) (interface{}, error) {
+	switch column {
+	case "size":
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return size, nil
+	case "created_at", "updated_at", "deleted_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	}
+	return value, nil
+}
+
+func encodeCursor(cursor fileCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string) (fileCursor, error) {
+	var cursor fileCursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(data, &cursor) != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
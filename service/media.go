@@ -0,0 +1,481 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"my-project/config"
+	"my-project/models"
+	"my-project/storage"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Bounds on how much of a file is read to extract its media information
+const (
+	maxPDFScan  = 64 * 1024 * 1024
+	maxMoovSize = 64 * 1024 * 1024
+)
+
+var errMediaUnreadable = errors.New("media information could not be read")
+
+// extractMedia reads the dimensions, page count, duration or codec of a
+// staged upload. It is best effort: unknown or malformed content yields an
+// empty MediaInfo.
+func extractMedia(ctx context.Context, staged *stagedBlob, mimeType string, head []byte) models.MediaInfo {
+	mimeType = baseType(mimeType)
+
+	var parse func(r io.Reader, size int64) (models.MediaInfo, error)
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		if _, _, err := image.DecodeConfig(bytes.NewReader(head)); err != nil {
+			return models.MediaInfo{}
+		}
+		parse = imageMedia
+	case mimeType == "application/pdf":
+		parse = pdfMedia
+	case mimeType == "audio/mpeg":
+		parse = mp3Media
+	case mimeType == "audio/wav" || mimeType == "audio/x-wav" || mimeType == "audio/vnd.wave" || mimeType == "audio/wave":
+		parse = wavMedia
+	case isMP4Type(mimeType):
+		parse = mp4Media
+	default:
+		return models.MediaInfo{}
+	}
+
+	store, err := storage.Disk(staged.Disk)
+	if err != nil {
+		return models.MediaInfo{}
+	}
+	reader, err := store.Get(ctx, staged.Key)
+	if err != nil {
+		return models.MediaInfo{}
+	}
+	defer reader.Close()
+
+	info, err := parse(reader, staged.Size)
+	if err != nil {
+		return models.MediaInfo{}
+	}
+	return info
+}
+
+// isMP4Type reports whether mimeType is an ISO base media container
+func isMP4Type(mimeType string) bool {
+	switch mimeType {
+	case "video/mp4", "audio/mp4", "video/quicktime", "audio/x-m4a", "video/x-m4v":
+		return true
+	}
+	return false
+}
+
+// imageMedia reads the dimensions of an image from its header, then decodes
+// it to compute its placeholders unless it exceeds TRANSFORM_MAX_PIXELS
+func imageMedia(r io.Reader, size int64) (models.MediaInfo, error) {
+	buffered := bufio.NewReaderSize(r, headLen)
+	head, err := buffered.Peek(headLen)
+	if err != nil && err != io.EOF {
+		return models.MediaInfo{}, err
+	}
+	header, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return models.MediaInfo{}, errMediaUnreadable
+	}
+	info := models.MediaInfo{Width: &header.Width, Height: &header.Height}
+
+	if int64(header.Width)*int64(header.Height) <= config.LoadTransformConfig().MaxPixels {
+		if src, _, err := image.Decode(buffered); err == nil {
+			info.BlurHash, info.DominantColor = placeholders(src)
+		}
+	}
+	return info, nil
+}
+
+// PDF page tree patterns. The root /Pages node carries the total page count.
+var (
+	pdfPagesCount = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+	pdfPage       = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfObjStm     = regexp.MustCompile(`/Type\s*/ObjStm\b[^>]*>>\s*stream\r?\n`)
+)
+
+// pdfMedia counts the pages of a PDF, looking into compressed object streams
+// where PDF 1.5+ files keep their page tree
+func pdfMedia(r io.Reader, size int64) (models.MediaInfo, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxPDFScan))
+	if err != nil {
+		return models.MediaInfo{}, err
+	}
+
+	count, pages := pdfPageCount(content)
+
+	// Object streams are inflated only until the page tree turns up, sharing
+	// one budget so that many streams cannot expand without bound
+	budget := int64(maxPDFScan)
+	for _, match := range pdfObjStm.FindAllIndex(content, -1) {
+		if count > 0 || budget <= 0 {
+			break
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(zlibReader(content[match[1]:]), budget))
+		budget -= int64(len(inflated))
+		streamCount, streamPages := pdfPageCount(inflated)
+		count, pages = max(count, streamCount), pages+streamPages
+	}
+	if count == 0 {
+		count = pages
+	}
+	if count == 0 {
+		return models.MediaInfo{}, errMediaUnreadable
+	}
+	return models.MediaInfo{PageCount: &count}, nil
+}
+
+// pdfPageCount returns the largest /Count of the page tree nodes found in
+// source and the number of page objects it holds
+func pdfPageCount(source []byte) (int, int) {
+	count := 0
+	for _, match := range pdfPagesCount.FindAllSubmatch(source, -1) {
+		value := match[1]
+		if len(value) == 0 {
+			value = match[2]
+		}
+		if n, err := strconv.Atoi(string(value)); err == nil && n > count {
+			count = n
+		}
+	}
+	return count, len(pdfPage.FindAll(source, -1))
+}
+
+// zlibReader inflates a FlateDecode stream, yielding nothing when it is not one
+func zlibReader(data []byte) io.Reader {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return bytes.NewReader(nil)
+	}
+	return reader
+}
+
+// wavMedia reads the format and data chunks of a RIFF/WAVE file
+func wavMedia(r io.Reader, size int64) (models.MediaInfo, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return models.MediaInfo{}, errMediaUnreadable
+	}
+
+	var format, byteRate uint32
+	for {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return models.MediaInfo{}, errMediaUnreadable
+		}
+		length := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			// Only the common 16 bytes are read, extensions are skipped below
+			if length < 16 {
+				return models.MediaInfo{}, errMediaUnreadable
+			}
+			body := make([]byte, 16)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return models.MediaInfo{}, errMediaUnreadable
+			}
+			format = uint32(binary.LittleEndian.Uint16(body[0:2]))
+			byteRate = binary.LittleEndian.Uint32(body[8:12])
+			length -= 16
+		case "data":
+			if byteRate == 0 {
+				return models.MediaInfo{}, errMediaUnreadable
+			}
+			if remaining := size - 12 - 8; length > remaining || length == 0xFFFFFFFF {
+				length = remaining // streamed recordings may not know their final size
+			}
+			duration := roundDuration(float64(length) / float64(byteRate))
+			return models.MediaInfo{Duration: &duration, Codec: wavCodec(format)}, nil
+		}
+		// Chunks are padded to an even size
+		if _, err := io.CopyN(io.Discard, r, length+length%2); err != nil {
+			return models.MediaInfo{}, errMediaUnreadable
+		}
+	}
+}
+
+// wavCodec names the audio format code of a WAVE file
+func wavCodec(format uint32) string {
+	switch format {
+	case 1, 0xFFFE:
+		return "pcm"
+	case 3:
+		return "pcm_float"
+	case 6:
+		return "alaw"
+	case 7:
+		return "mulaw"
+	}
+	return fmt.Sprintf("wav_0x%04x", format)
+}
+
+// MPEG audio frame tables indexed by version (0 = MPEG-1, 1 = MPEG-2/2.5) and layer - 1
+var (
+	mp3Bitrates = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mp3SampleRates = map[int][3]int{
+		3: {44100, 48000, 32000}, // MPEG-1
+		2: {22050, 24000, 16000}, // MPEG-2
+		0: {11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+// mp3Media computes the duration of an MP3 from its Xing/Info header, or
+// from the bitrate of the first frame for constant bitrate files
+func mp3Media(r io.Reader, size int64) (models.MediaInfo, error) {
+	head := make([]byte, headLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return models.MediaInfo{}, errMediaUnreadable
+	}
+	head = head[:n]
+
+	// Skip an ID3v2 tag, whose size is stored as a syncsafe integer
+	offset := 0
+	if len(head) >= 10 && string(head[0:3]) == "ID3" {
+		offset = 10 + (int(head[6])<<21 | int(head[7])<<14 | int(head[8])<<7 | int(head[9]))
+	}
+	for offset+4 <= len(head) && !(head[offset] == 0xFF && head[offset+1]&0xE0 == 0xE0) {
+		offset++
+	}
+	if offset+4 > len(head) {
+		return models.MediaInfo{}, errMediaUnreadable
+	}
+
+	frame := head[offset:]
+	versionBits := int(frame[1]>>3) & 0x03
+	layer := 4 - int(frame[1]>>1)&0x03
+	bitrateIndex := int(frame[2] >> 4)
+	rateIndex := int(frame[2]>>2) & 0x03
+	rates, ok := mp3SampleRates[versionBits]
+	if !ok || layer < 1 || layer > 3 || rateIndex == 3 || bitrateIndex == 0 || bitrateIndex == 15 {
+		return models.MediaInfo{}, errMediaUnreadable
+	}
+	version := 0
+	if versionBits != 3 {
+		version = 1
+	}
+	bitrate := mp3Bitrates[version][layer-1][bitrateIndex] * 1000
+	sampleRate := rates[rateIndex]
+	samplesPerFrame := 1152
+	switch {
+	case layer == 1:
+		samplesPerFrame = 384
+	case layer == 3 && version == 1:
+		samplesPerFrame = 576
+	}
+
+	codec := "mp" + strconv.Itoa(layer)
+	for _, tag := range []string{"Xing", "Info"} {
+		i := bytes.Index(frame[:min(len(frame), 64)], []byte(tag))
+		if i < 0 || i+12 > len(frame) || binary.BigEndian.Uint32(frame[i+4:])&0x1 == 0 {
+			continue
+		}
+		frames := binary.BigEndian.Uint32(frame[i+8:])
+		duration := roundDuration(float64(frames) * float64(samplesPerFrame) / float64(sampleRate))
+		return models.MediaInfo{Duration: &duration, Codec: codec}, nil
+	}
+
+	duration := roundDuration(float64(size-int64(offset)) * 8 / float64(bitrate))
+	return models.MediaInfo{Duration: &duration, Codec: codec}, nil
+}
+
+// mp4Media reads the movie header and sample descriptions of an ISO base
+// media file (MP4, M4A, MOV). The moov box may follow the media data, so
+// other top-level boxes are skipped without being buffered.
+func mp4Media(r io.Reader, size int64) (models.MediaInfo, error) {
+	for {
+		boxType, length, err := readBoxHeader(r)
+		if err != nil {
+			return models.MediaInfo{}, errMediaUnreadable
+		}
+		if boxType != "moov" {
+			if length < 0 {
+				return models.MediaInfo{}, errMediaUnreadable
+			}
+			if err := skip(r, length); err != nil {
+				return models.MediaInfo{}, errMediaUnreadable
+			}
+			continue
+		}
+		// The declared length is untrusted, so the box is read as it arrives
+		// rather than allocated up front
+		if length < 0 || length > maxMoovSize || length > size {
+			return models.MediaInfo{}, errMediaUnreadable
+		}
+		moov, err := io.ReadAll(io.LimitReader(r, length))
+		if err != nil || int64(len(moov)) < length {
+			return models.MediaInfo{}, errMediaUnreadable
+		}
+		return parseMoov(moov), nil
+	}
+}
+
+// readBoxHeader returns the type and payload length of the next box, -1
+// when the box extends to the end of the file
+func readBoxHeader(r io.Reader) (string, int64, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[0:4]))
+	boxType := string(header[4:8])
+	switch size {
+	case 0:
+		return boxType, -1, nil
+	case 1:
+		large := make([]byte, 8)
+		if _, err := io.ReadFull(r, large); err != nil {
+			return "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(large)) - 8
+	}
+	if size < 8 {
+		return "", 0, errMediaUnreadable
+	}
+	return boxType, size - 8, nil
+}
+
+// skip discards n bytes, seeking when the reader allows it
+func skip(r io.Reader, n int64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err := seeker.Seek(n, io.SeekCurrent)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
+
+// mp4Box is a box located inside an in-memory parent
+type mp4Box struct {
+	Type string
+	Data []byte
+}
+
+// childBoxes splits the payload of a container box
+func childBoxes(data []byte) []mp4Box {
+	var boxes []mp4Box
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data[0:4]))
+		header := 8
+		if size == 1 && len(data) >= 16 {
+			size = int(binary.BigEndian.Uint64(data[8:16]))
+			header = 16
+		} else if size == 0 {
+			size = len(data)
+		}
+		if size < header || size > len(data) {
+			break
+		}
+		boxes = append(boxes, mp4Box{Type: string(data[4:8]), Data: data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// findBox follows a path of box types below data
+func findBox(data []byte, path ...string) []byte {
+	for _, boxType := range path {
+		found := false
+		for _, box := range childBoxes(data) {
+			if box.Type == boxType {
+				data, found = box.Data, true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return data
+}
+
+// parseMoov reads the duration, video dimensions and track codecs of a moov box
+func parseMoov(moov []byte) models.MediaInfo {
+	var info models.MediaInfo
+	if mvhd := findBox(moov, "mvhd"); len(mvhd) >= 20 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 && len(mvhd) >= 32 {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+			duration = binary.BigEndian.Uint64(mvhd[24:32])
+		} else {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+			duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+		}
+		if timescale > 0 {
+			seconds := roundDuration(float64(duration) / float64(timescale))
+			info.Duration = &seconds
+		}
+	}
+
+	var codecs []string
+	for _, trak := range childBoxes(moov) {
+		if trak.Type != "trak" {
+			continue
+		}
+		stsd := findBox(trak.Data, "mdia", "minf", "stbl", "stsd")
+		if len(stsd) >= 16 {
+			codecs = append(codecs, strings.TrimSpace(string(stsd[12:16])))
+		}
+
+		// Track dimensions are 16.16 fixed point values at the end of tkhd
+		if tkhd := findBox(trak.Data, "tkhd"); len(tkhd) >= 84 && info.Width == nil {
+			width := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16)
+			height := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16)
+			if width > 0 && height > 0 {
+				info.Width, info.Height = &width, &height
+			}
+		}
+	}
+	info.Codec = strings.Join(codecs, ",")
+	return info
+}
+
+// roundDuration keeps durations to the millisecond
+func roundDuration(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
+
+// mediaResponse adds the media information that is known to a file response
+func mediaResponse(response map[string]interface{}, media models.MediaInfo) {
+	if media.Width != nil && media.Height != nil {
+		response["width"] = *media.Width
+		response["height"] = *media.Height
+	}
+	if media.PageCount != nil {
+		response["page_count"] = *media.PageCount
+	}
+	if media.Duration != nil {
+		response["duration"] = *media.Duration
+	}
+	if media.Codec != "" {
+		response["codec"] = media.Codec
+	}
+	if media.BlurHash != "" {
+		response["blurhash"] = media.BlurHash
+		response["dominant_color"] = media.DominantColor
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"my-project/models"
+	"testing"
+)
+
+// box encodes an ISO base media box
+func box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	header := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(header, boxType...), body...)
+}
+
+// mp4File builds a file whose moov box, placed after the media data, holds a
+// movie header and one video track
+func mp4File(timescale, duration uint32, width, height uint16, codec string) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], uint32(height)<<16)
+	stsd := append(make([]byte, 8), box(codec)...)
+	trak := box("trak", box("tkhd", tkhd), box("mdia", box("minf", box("stbl", box("stsd", stsd)))))
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isom")),
+		box("mdat", make([]byte, 1000)),
+		box("moov", box("mvhd", mvhd), trak),
+	}, nil)
+}
+
+// wavFile builds a RIFF/WAVE file with a fmt chunk of fmtLen bytes
+func wavFile(format uint16, byteRate uint32, fmtLen uint32, data int) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.WriteString("WAVE")
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, fmtLen)
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint16(body[0:], format)
+	binary.LittleEndian.PutUint32(body[8:], byteRate)
+	if fmtLen >= 16 {
+		b.Write(body)
+		b.Write(make([]byte, fmtLen-16))
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(data))
+	b.Write(make([]byte, data))
+	return b.Bytes()
+}
+
+// mp3File builds an MPEG-1 layer III file at 128 kbps and 44.1 kHz behind an
+// ID3v2 tag of tagLen bytes, with the sync bytes of a bogus frame in the tag
+func mp3File(tagLen int, xingFrames uint32, audio int) []byte {
+	tag := make([]byte, tagLen)
+	if tagLen > 8 {
+		copy(tag[tagLen-8:], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	header := []byte{'I', 'D', '3', 4, 0, 0,
+		byte(tagLen >> 21 & 0x7F), byte(tagLen >> 14 & 0x7F), byte(tagLen >> 7 & 0x7F), byte(tagLen & 0x7F)}
+	frame := make([]byte, audio)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	if xingFrames > 0 {
+		copy(frame[36:], "Xing")
+		binary.BigEndian.PutUint32(frame[40:], 1)
+		binary.BigEndian.PutUint32(frame[44:], xingFrames)
+	}
+	return bytes.Join([][]byte{header, tag, frame}, nil)
+}
+
+// objStm wraps objects in a compressed object stream
+func objStm(objects string) string {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte(objects))
+	w.Close()
+	return "5 0 obj\n<< /Type /ObjStm /N 1 /First 4 /Filter /FlateDecode >>\nstream\n" + compressed.String() + "\nendstream\nendobj\n"
+}
+
+func TestMediaParsers(t *testing.T) {
+	type parser func(r io.Reader, size int64) (models.MediaInfo, error)
+	tests := []struct {
+		name     string
+		parse    parser
+		content  []byte
+		duration float64
+		pages    int
+		width    int
+		height   int
+		codec    string
+		wantErr  bool
+	}{
+		{
+			name:     "wav",
+			parse:    wavMedia,
+			content:  wavFile(1, 16000, 16, 32000),
+			duration: 2,
+			codec:    "pcm",
+		},
+		{
+			name:     "wav with an extended fmt chunk",
+			parse:    wavMedia,
+			content:  wavFile(3, 8000, 18, 4000),
+			duration: 0.5,
+			codec:    "pcm_float",
+		},
+		{name: "wav with a short fmt chunk", parse: wavMedia, content: wavFile(1, 16000, 8, 100), wantErr: true},
+		{name: "wav with a huge fmt chunk", parse: wavMedia, content: []byte("RIFF\x00\x00\x00\x00WAVEfmt \xf0\xff\xff\xff\x01\x00"), wantErr: true},
+		{name: "not a wav", parse: wavMedia, content: []byte("RIFF\x00\x00\x00\x00AVI "), wantErr: true},
+		{
+			name:     "mp3 at a constant bitrate",
+			parse:    mp3Media,
+			content:  mp3File(200, 0, 16000),
+			duration: 1,
+			codec:    "mp3",
+		},
+		{
+			name:     "mp3 with a xing header",
+			parse:    mp3Media,
+			content:  mp3File(300, 1000, 2000),
+			duration: 26.122,
+			codec:    "mp3",
+		},
+		{name: "not an mp3", parse: mp3Media, content: []byte("not audio at all"), wantErr: true},
+		{
+			name:     "mp4",
+			parse:    mp4Media,
+			content:  mp4File(1000, 12500, 1920, 1080, "avc1"),
+			duration: 12.5,
+			width:    1920,
+			height:   1080,
+			codec:    "avc1",
+		},
+		{
+			name:    "mp4 with a moov longer than the file",
+			parse:   mp4Media,
+			content: append(box("ftyp", []byte("isom")), 0x03, 0x00, 0x00, 0x00, 'm', 'o', 'o', 'v'),
+			wantErr: true,
+		},
+		{name: "mp4 without a moov", parse: mp4Media, content: box("ftyp", []byte("isom")), wantErr: true},
+		{
+			name:    "pdf",
+			parse:   pdfMedia,
+			content: []byte("%PDF-1.4\n1 0 obj\n<< /Type /Pages /Kids [2 0 R] /Count 3 >>\nendobj\n"),
+			pages:   3,
+		},
+		{
+			name:    "pdf counted by its pages",
+			parse:   pdfMedia,
+			content: []byte("%PDF-1.4\n2 0 obj\n<< /Type /Page >>\nendobj\n3 0 obj\n<< /Type /Page >>\nendobj\n"),
+			pages:   2,
+		},
+		{
+			name:    "pdf with an object stream",
+			parse:   pdfMedia,
+			content: []byte("%PDF-1.5\n" + objStm("1 0 << /Type /Pages /Kids [2 0 R] /Count 7 >>")),
+			pages:   7,
+		},
+		{name: "pdf without pages", parse: pdfMedia, content: []byte("%PDF-1.4\n%%EOF\n"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := tt.parse(bytes.NewReader(tt.content), int64(len(tt.content)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parse() = %+v, want an error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if tt.duration > 0 && (info.Duration == nil || *info.Duration != tt.duration) {
+				t.Errorf("duration = %v, want %v", info.Duration, tt.duration)
+			}
+			if tt.pages > 0 && (info.PageCount == nil || *info.PageCount != tt.pages) {
+				t.Errorf("page count = %v, want %v", info.PageCount, tt.pages)
+			}
+			if tt.width > 0 && (info.Width == nil || *info.Width != tt.width || *info.Height != tt.height) {
+				t.Errorf("dimensions = %v x %v, want %d x %d", info.Width, info.Height, tt.width, tt.height)
+			}
+			if info.Codec != tt.codec {
+				t.Errorf("codec = %q, want %q", info.Codec, tt.codec)
+			}
+		})
+	}
+}
+
+func TestPDFMediaInflateBudget(t *testing.T) {
+	// Streams after the one holding the page tree are not inflated, even
+	// when they would expand past the scan limit
+	var bomb bytes.Buffer
+	w := zlib.NewWriter(&bomb)
+	w.Write(make([]byte, 8<<20))
+	w.Close()
+	content := "%PDF-1.5\n" + objStm("1 0 << /Type /Pages /Count 2 >>")
+	for range 20 {
+		content += "6 0 obj\n<< /Type /ObjStm /N 1 /First 4 >>\nstream\n" + bomb.String() + "\nendstream\nendobj\n"
+	}
+
+	info, err := pdfMedia(bytes.NewReader([]byte(content)), int64(len(content)))
+	if err != nil {
+		t.Fatalf("pdfMedia() error = %v", err)
+	}
+	if info.PageCount == nil || *info.PageCount != 2 {
+		t.Errorf("page count = %v, want 2", info.PageCount)
+	}
+}
+
+func TestMP3ID3Size(t *testing.T) {
+	// A tag whose syncsafe size sets bits the header length also sets must
+	// still be skipped whole, not from a misparsed offset inside it
+	for _, tagLen := range []int{200, 1 << 7, 1<<14 + 10} {
+		content := mp3File(tagLen, 0, 4000)
+		info, err := mp3Media(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Errorf("mp3Media() with a %d byte tag: error = %v", tagLen, err)
+			continue
+		}
+		if info.Duration == nil || *info.Duration != 0.25 {
+			t.Errorf("mp3Media() with a %d byte tag: duration = %v, want 0.25", tagLen, info.Duration)
+		}
+	}
+	if _, err := mp3Media(bytes.NewReader(nil), 0); !errors.Is(err, errMediaUnreadable) {
+		t.Errorf("mp3Media() of nothing: error = %v, want %v", err, errMediaUnreadable)
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"my-project/models"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Limits on the tags and custom metadata of a file
+const (
+	maxTags         = 50
+	maxTagLen       = 100
+	maxMetaKeys     = 50
+	maxMetaKeyLen   = 100
+	maxMetaValueLen = 255
+)
+
+// ErrInvalidMetadata is returned when tags or metadata break the limits above
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+// metaKeyPattern restricts keys to characters usable in a meta.<key> query parameter
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// NormalizeTags trims and deduplicates tags, dropping empty ones
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLen {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidMetadata, tag, maxTagLen)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidMetadata, maxTags)
+	}
+	return normalized, nil
+}
+
+// checkMetaEntry validates a single metadata key and value
+func checkMetaEntry(key, value string) error {
+	if len(key) > maxMetaKeyLen || !metaKeyPattern.MatchString(key) {
+		return fmt.Errorf("%w: key %q must be at most %d letters, digits, '.', '-' or '_'", ErrInvalidMetadata, key, maxMetaKeyLen)
+	}
+	if len(value) > maxMetaValueLen {
+		return fmt.Errorf("%w: value of %q is longer than %d characters", ErrInvalidMetadata, key, maxMetaValueLen)
+	}
+	return nil
+}
+
+// checkMetadata validates custom metadata given at upload time
+func checkMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetaKeys {
+		return fmt.Errorf("%w: at most %d metadata keys are allowed", ErrInvalidMetadata, maxMetaKeys)
+	}
+	for key, value := range metadata {
+		if err := checkMetaEntry(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileTags builds the tag rows of a file
+func fileTags(tags []string) []models.FileTag {
+	rows := make([]models.FileTag, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, models.FileTag{Tag: tag})
+	}
+	return rows
+}
+
+// fileMetadata builds the metadata rows of a file, sorted by key
+func fileMetadata(metadata map[string]string) []models.FileMeta {
+	rows := make([]models.FileMeta, 0, len(metadata))
+	for key, value := range metadata {
+		rows = append(rows, models.FileMeta{Key: key, Value: value})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	return rows
+}
+
+// withDetails preloads the tags, metadata and preset derivatives of the files loaded through db
+func withDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("Derivatives", func(db *gorm.DB) *gorm.DB {
+		return db.Order("preset ASC")
+	}).Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("tag ASC")
+	}).Preload("Metadata", func(db *gorm.DB) *gorm.DB {
+		return db.Order("meta_key ASC")
+	})
+}
+
+// MetadataUpdate describes a change to the tags and metadata of a file
+type MetadataUpdate struct {
+	Tags     *[]string          // replaces every tag when set
+	Metadata map[string]*string // sets each key, or removes it when nil
+}
+
+// UpdateMetadata applies a metadata update to a live file of tenant
+func UpdateMetadata(tenant, filename string, update MetadataUpdate) (*models.File, error) {
+	var tags []string
+	if update.Tags != nil {
+		var err error
+		if tags, err = NormalizeTags(*update.Tags); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range update.Metadata {
+		if value == nil {
+			continue
+		}
+		if err := checkMetaEntry(key, *value); err != nil {
+			return nil, err
+		}
+	}
+
+	var file *models.File
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if file, err = lockFile(tx, tenant, filename); err != nil {
+			return err
+		}
+
+		if update.Tags != nil {
+			if err := tx.Where("file_id = ?", file.ID).Delete(&models.FileTag{}).Error; err != nil {
+				return err
+			}
+			if rows := fileTags(tags); len(rows) > 0 {
+				for i := range rows {
+					rows[i].FileID = file.ID
+				}
+				if err := tx.Create(&rows).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		for key, value := range update.Metadata {
+			if value == nil {
+				if err := tx.Where("file_id = ? AND meta_key = ?", file.ID, key).Delete(&models.FileMeta{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			row := models.FileMeta{FileID: file.ID, Key: key, Value: *value}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "file_id"}, {Name: "meta_key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"meta_value"}),
+			}).Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&models.FileMeta{}).Where("file_id = ?", file.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > maxMetaKeys {
+			return fmt.Errorf("%w: at most %d metadata keys are allowed", ErrInvalidMetadata, maxMetaKeys)
+		}
+
+		return withDetails(tx).First(file, file.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// metadataResponse renders the tags and metadata of a file
+func metadataResponse(file *models.File) ([]string, map[string]string) {
+	tags := make([]string, 0, len(file.Tags))
+	for _, tag := range file.Tags {
+		tags = append(tags, tag.Tag)
+	}
+	metadata := make(map[string]string, len(file.Metadata))
+	for _, meta := range file.Metadata {
+		metadata[meta.Key] = meta.Value
+	}
+	return tags, metadata
+}
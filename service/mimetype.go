@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Errors returned when the content of an upload does not match its metadata
+var (
+	ErrMimeMismatch   = errors.New("file content does not match its declared type")
+	ErrExtMismatch    = errors.New("file content does not match its extension")
+	ErrTypeNotAllowed = errors.New("file type is not allowed")
+)
+
+// textTypes are declared types accepted for any content detected as plain text
+var textTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-yaml",
+	"application/yaml",
+	"application/x-sh",
+	"application/sql",
+}
+
+// DetectMimeType identifies the content type from the leading bytes of a file.
+// It recognizes office documents, archives, audio, video and fonts in addition
+// to what http.DetectContentType knows about.
+func DetectMimeType(head []byte) *mimetype.MIME {
+	return mimetype.Detect(head)
+}
+
+// isGenericType reports whether a declared type carries no information
+func isGenericType(mimeType string) bool {
+	switch baseType(mimeType) {
+	case "", "application/octet-stream", "binary/octet-stream", "application/unknown":
+		return true
+	}
+	return false
+}
+
+// baseType strips parameters such as charset and lowercases the type
+func baseType(mimeType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+}
+
+// compatibleType reports whether the content detected as detected may
+// legitimately be declared as declared
+func compatibleType(declared string, detected *mimetype.MIME) bool {
+	if isGenericType(declared) {
+		return true
+	}
+	// The declared type may be the detected type, an alias or one of its parents (zip for docx)
+	for node := detected; node != nil; node = node.Parent() {
+		if node.Is(declared) {
+			return true
+		}
+	}
+	// Plain text content can be any text based format we cannot tell apart
+	if detected.Is("text/plain") || (detected.Parent() != nil && detected.Parent().Is("text/plain")) {
+		declared = baseType(declared)
+		if strings.HasPrefix(declared, "text/") {
+			return true
+		}
+		for _, textType := range textTypes {
+			if declared == textType {
+				return true
+			}
+		}
+	}
+	// Unrecognized binary content only conflicts with types we know how to detect
+	if detected.Is("application/octet-stream") {
+		return mimetype.Lookup(baseType(declared)) == nil
+	}
+	return false
+}
+
+// compatibleExtension reports whether the file name extension agrees with the detected content
+func compatibleExtension(name string, detected *mimetype.MIME) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return true
+	}
+	for node := detected; node != nil; node = node.Parent() {
+		if node.Extension() == ext {
+			return true
+		}
+	}
+	byExt := mime.TypeByExtension(ext)
+	if byExt == "" {
+		// Unknown extensions carry no claim about the content
+		return true
+	}
+	return compatibleType(byExt, detected)
+}
+
+// checkContentType rejects uploads whose extension, declared type and content disagree
+func checkContentType(name, declared string, detected *mimetype.MIME) error {
+	if !compatibleType(declared, detected) {
+		return fmt.Errorf("%w: declared %s, detected %s", ErrMimeMismatch, baseType(declared), detected.String())
+	}
+	if !compatibleExtension(name, detected) {
+		return fmt.Errorf("%w: %s is %s", ErrExtMismatch, filepath.Ext(name), detected.String())
+	}
+	return nil
+}
+
+// MatchMimeType reports whether mimeType matches one of the patterns.
+// Patterns are exact types ("image/png") or wildcards ("image/*", "*/*").
+func MatchMimeType(patterns []string, mimeType string) bool {
+	mimeType = baseType(mimeType)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), mimeType); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Placeholders are computed on a downscaled copy of the image, with a BlurHash
+// of blurHashComponents along its longer side and one less along the other
+const (
+	placeholderSize    = 64
+	blurHashComponents = 4
+)
+
+// base83 is the BlurHash alphabet
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// placeholders computes the BlurHash and dominant color of an image
+func placeholders(src image.Image) (string, string) {
+	bounds := src.Bounds()
+	if bounds.Empty() {
+		return "", ""
+	}
+	scale := math.Min(1, float64(placeholderSize)/float64(max(bounds.Dx(), bounds.Dy())))
+	small := image.NewNRGBA(image.Rect(0, 0, scaled(float64(bounds.Dx()), scale), scaled(float64(bounds.Dy()), scale)))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), src, bounds, draw.Src, nil)
+
+	xComponents, yComponents := blurHashComponents, blurHashComponents-1
+	if bounds.Dy() > bounds.Dx() {
+		xComponents, yComponents = yComponents, xComponents
+	}
+	return blurHash(small, xComponents, yComponents), dominantColor(small)
+}
+
+// blurHash encodes img following https://github.com/woltapp/blurhash.
+// Transparent areas are flattened on white.
+func blurHash(img *image.NRGBA, xComponents, yComponents int) string {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+
+	// Linear RGB values of every pixel
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := img.PixOffset(x, y)
+			alpha := float64(img.Pix[offset+3]) / 255
+			for c := 0; c < 3; c++ {
+				value := float64(img.Pix[offset+c])*alpha + 255*(1-alpha)
+				linear[y*width+x][c] = sRGBToLinear(value)
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * linear[y*width+x][c]
+					}
+				}
+			}
+			for c := 0; c < 3; c++ {
+				factor[c] /= float64(width * height)
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		actual := 0.0
+		for _, factor := range ac {
+			actual = math.Max(actual, math.Max(math.Abs(factor[0]), math.Max(math.Abs(factor[1]), math.Abs(factor[2]))))
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		hash.WriteString(encode83(quantised, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, factor := range ac {
+		value := 0
+		for _, component := range factor {
+			quantised := int(math.Max(0, math.Min(18, math.Floor(signPow(component/maximum, 0.5)*9+9.5))))
+			value = value*19 + quantised
+		}
+		hash.WriteString(encode83(value, 2))
+	}
+	return hash.String()
+}
+
+// dominantColor returns the average of the most common color bucket, ignoring
+// mostly transparent pixels
+func dominantColor(img *image.NRGBA) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var top *bucket
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			p := img.Pix[img.PixOffset(x, y):]
+			if p[3] < 128 {
+				continue
+			}
+			key := int(p[0]>>4)<<8 | int(p[1]>>4)<<4 | int(p[2]>>4)
+			b := buckets[key]
+			if b == nil {
+				b = &bucket{}
+				buckets[key] = b
+			}
+			b.count++
+			b.r, b.g, b.b = b.r+int(p[0]), b.g+int(p[1]), b.b+int(p[2])
+			if top == nil || b.count > top.count {
+				top = b
+			}
+		}
+	}
+	if top == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", top.r/top.count, top.g/top.count, top.b/top.count)
+}
+
+// encode83 writes value as length base 83 digits
+func encode83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+func sRGBToLinear(value float64) float64 {
+	v := value / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"my-project/config"
+	"time"
+)
+
+// Errors returned when checking a signed upload policy
+var (
+	ErrPolicyExpired = errors.New("upload policy has expired")
+)
+
+// UploadPolicy is the signed document authorizing a direct browser upload
+type UploadPolicy struct {
+	Expiration   time.Time `json:"expiration"`
+	AllowedTypes []string  `json:"allowed_types,omitempty"` // mime patterns such as "image/*"
+	MinSize      int64     `json:"min_size,omitempty"`
+	MaxSize      int64     `json:"max_size"`
+	Folder       string    `json:"folder,omitempty"`
+	UploadedBy   string    `json:"uploaded_by,omitempty"` // subject the policy was issued to
+	Tenant       string    `json:"tenant,omitempty"`      // tenant the upload is stored for
+	Visibility   string    `json:"visibility,omitempty"`  // visibility of the stored file
+}
+
+// SignUploadPolicy encodes the policy and returns it together with its signature
+func SignUploadPolicy(policy UploadPolicy) (string, string, error) {
+	cfg := config.LoadSigningConfig()
+	if cfg.Secret == "" {
+		return "", "", ErrSigningDisabled
+	}
+	if policy.MaxSize <= 0 {
+		return "", "", errors.New("max_size must be greater than zero")
+	}
+	if policy.MinSize < 0 || policy.MinSize > policy.MaxSize {
+		return "", "", errors.New("min_size must be between zero and max_size")
+	}
+	if policy.Visibility != "" {
+		if _, err := fileVisibility(policy.Visibility); err != nil {
+			return "", "", err
+		}
+	}
+
+	document, err := json.Marshal(policy)
+	if err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(document)
+	return encoded, signature(cfg.Secret, "upload-policy", encoded), nil
+}
+
+// VerifyUploadPolicy checks the signature and expiry of an encoded policy
+func VerifyUploadPolicy(encoded, sig string) (*UploadPolicy, error) {
+	cfg := config.LoadSigningConfig()
+	if cfg.Secret == "" {
+		return nil, ErrSigningDisabled
+	}
+	expected := signature(cfg.Secret, "upload-policy", encoded)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return nil, ErrInvalidSignature
+	}
+
+	document, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	var policy UploadPolicy
+	if err := json.Unmarshal(document, &policy); err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if time.Now().After(policy.Expiration) {
+		return nil, ErrPolicyExpired
+	}
+	return &policy, nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"my-project/config"
+	"my-project/models"
+	"my-project/storage"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// presetTransform converts an image preset to the transformation rendering
+// it. Presets never enlarge images smaller than their box.
+func presetTransform(preset config.ImagePreset) *Transform {
+	fit := preset.Fit
+	if fit == "" {
+		fit = "contain"
+	}
+	return &Transform{
+		Width:      preset.Width,
+		Height:     preset.Height,
+		Fit:        fit,
+		Format:     preset.Format,
+		Quality:    preset.Quality,
+		shrinkOnly: true,
+	}
+}
+
+// applyPresets renders the named presets of an image as derivative files
+// linked to it, replacing earlier derivatives of the same presets. The
+// derivatives are planned on file right away so their URIs can be returned;
+// with IMAGE_PRESETS_ASYNC they are rendered in the background. Failures are
+// logged and never fail the upload of the original.
+func applyPresets(ctx context.Context, file *models.File, names []string) {
+	if len(names) == 0 || sourceFormat(file.MimeType) == "" {
+		return
+	}
+	presets, err := config.LoadImagePresets()
+	if err != nil {
+		log.Println("⚠️ Image presets unavailable:", err)
+		return
+	}
+
+	var planned []models.File
+	for _, name := range names {
+		preset, ok := presets[name]
+		if !ok {
+			log.Printf("⚠️ Image preset %q is not configured", name)
+			continue
+		}
+		format := preset.Format
+		if format == "" {
+			format = sourceFormat(file.MimeType)
+		}
+		planned = append(planned, models.File{
+			Filename:     uuid.New().String(),
+			OriginalName: strings.TrimSuffix(file.OriginalName, path.Ext(file.OriginalName)) + "-" + name + "." + format,
+			MimeType:     "image/" + format,
+			FolderID:     file.FolderID,
+			Folder:       file.Folder,
+			ParentID:     &file.ID,
+			Preset:       name,
+			Version:      1,
+			Tenant:       file.Tenant,
+			UploadedBy:   file.UploadedBy,
+			OwnerID:      file.OwnerID,
+			Visibility:   file.Visibility,
+		})
+	}
+
+	source := *file
+	render := func(ctx context.Context) []models.File {
+		rendered := make([]models.File, 0, len(planned))
+		for _, derivative := range planned {
+			if err := renderPreset(ctx, &source, &derivative, presets[derivative.Preset]); err != nil {
+				log.Printf("⚠️ Rendering preset %q of %s failed: %v", derivative.Preset, source.Filename, err)
+				continue
+			}
+			rendered = append(rendered, derivative)
+		}
+		return rendered
+	}
+
+	if config.PresetsAsync() {
+		file.Derivatives = planned
+		go render(context.Background())
+		return
+	}
+	file.Derivatives = render(ctx)
+}
+
+// renderPreset renders one preset of source and records it as derivative,
+// purging the derivative it replaces
+func renderPreset(ctx context.Context, source, derivative *models.File, preset config.ImagePreset) error {
+	store, err := storage.Disk(source.Disk)
+	if err != nil {
+		return err
+	}
+	reader, err := store.Get(ctx, source.Path)
+	if err != nil {
+		return err
+	}
+	var rendered bytes.Buffer
+	err = renderTransform(reader, presetTransform(preset), strings.TrimPrefix(derivative.MimeType, "image/"), &rendered)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	staged, err := stageBlob(ctx, source.Tenant, bytes.NewReader(rendered.Bytes()), int64(rendered.Len()), derivative.MimeType)
+	if err != nil {
+		return err
+	}
+
+	var replaced []models.File
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("parent_id = ? AND preset = ?", source.ID, derivative.Preset).Find(&replaced).Error
+		if err != nil {
+			return err
+		}
+		blob, err := commitBlob(ctx, tx, staged)
+		if err != nil {
+			return err
+		}
+		derivative.BlobID = &blob.ID
+		derivative.Disk = blob.Disk
+		derivative.Path = blob.Path
+		derivative.Hash = blob.Hash
+		derivative.Size = blob.Size
+		derivative.Media, _ = imageMedia(bytes.NewReader(rendered.Bytes()), int64(rendered.Len()))
+		derivative.CreatedAt = time.Now()
+		derivative.UpdatedAt = time.Now()
+		return tx.Create(derivative).Error
+	})
+	if err != nil {
+		staged.abort()
+		return err
+	}
+	staged.finish()
+
+	for i := range replaced {
+		if err := PurgeFile(ctx, &replaced[i]); err != nil {
+			return fmt.Errorf("purging replaced derivative: %w", err)
+		}
+	}
+	return nil
+}
+
+// derivativePresets lists the presets a file has derivatives for
+func derivativePresets(file *models.File) []string {
+	names := make([]string, 0, len(file.Derivatives))
+	for _, derivative := range file.Derivatives {
+		names = append(names, derivative.Preset)
+	}
+	return names
+}
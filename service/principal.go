@@ -0,0 +1,39 @@
+package service
+
+import (
+	"my-project/models"
+	"slices"
+	"strings"
+)
+
+// Principal is the authenticated caller of a request, identified by an API
+// key or a bearer token
+type Principal struct {
+	Subject string
+	Tenant  string
+	Scopes  []string
+	Groups  []string       // groups ACL entries can grant permissions to
+	APIKey  *models.APIKey // set when authenticated with an API key
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Authenticate resolves the credentials of a request, an API key or a JWT
+func Authenticate(token string) (*Principal, error) {
+	if !strings.HasPrefix(token, apiKeyPrefix) {
+		return AuthenticateJWT(token)
+	}
+	key, err := AuthenticateAPIKey(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{
+		Subject: "key:" + key.Prefix,
+		Tenant:  key.Tenant,
+		Scopes:  KeyScopes(key),
+		APIKey:  key,
+	}, nil
+}
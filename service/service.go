@@ -1,32 +1,35 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"io"
 	"mime"
-	"mime/multipart"
+	"my-project/config"
 	"my-project/models"
+	"my-project/storage"
+	"net/http"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// ReadFile reads a file from the database or serves it from the public folder if not found in DB
-func ReadFile(filename string, download bool, c *gin.Context) error {
+// ReadFile reads a file of tenant from the database or serves it from the public folder if not found in DB
+func ReadFile(tenant, filename string, download bool, c *gin.Context) error {
 	var file models.File
 
 	// Try fetching file details from the database
-	err := models.DB.Where("filename = ?", filename).First(&file).Error
+	err := models.DB.Where("tenant = ? AND filename = ?", tenant, filename).First(&file).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			// Fallback: Try serving from public folder
-			publicPath := filepath.Join("public/static", filename)
+			publicPath := filepath.Join(config.StaticRoot, filename)
 
 			if _, err := os.Stat(publicPath); os.IsNotExist(err) {
-				return errors.New("file not found in database or public folder")
+				return ErrFileNotFound
 			}
 
 			// Optionally detect MIME type based on extension
@@ -48,131 +51,124 @@ func ReadFile(filename string, download bool, c *gin.Context) error {
 		return err
 	}
 
-	// If found in DB, ensure file exists
-	if _, err := os.Stat(file.Path); os.IsNotExist(err) {
-		return errors.New("file found in database but missing on disk")
-	}
-
-	c.Header("Content-Type", file.MimeType)
+	disposition := "inline"
 	if download {
-		c.Header("Content-Disposition", "attachment; filename="+file.OriginalName)
-	} else {
-		c.Header("Content-Disposition", "inline; filename="+file.OriginalName)
+		disposition = "attachment"
 	}
-
-	c.File(file.Path)
-	return nil
+	return serveObject(c, file.Disk, file.Path, file.MimeType, disposition+"; filename="+file.OriginalName)
 }
 
-// UpdateFile updates file information in the database and replaces the file if a new one is provided.
-func UploadFile(file *multipart.FileHeader) (map[string]interface{}, error) {
-	// Create upload folder if it doesn't exist
-	uploadFolder := "public/uploads"
-	if err := os.MkdirAll(uploadFolder, os.ModePerm); err != nil {
-		return nil, errors.New("failed to create upload directory")
+// serveObject streams an object from its disk, supporting range requests
+// whenever the backend returns a seekable reader
+func serveObject(c *gin.Context, disk, key, mimeType, disposition string) error {
+	store, err := storage.Disk(disk)
+	if err != nil {
+		return err
 	}
 
-	// Generate a unique file name without extension
-	fileName := uuid.New().String() // No file extension added here
-	filePath := filepath.Join(uploadFolder, fileName)
-
-	// Open the uploaded file
-	src, err := file.Open()
+	ctx := c.Request.Context()
+	info, err := store.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return errors.New("file found in database but missing on disk")
+	}
 	if err != nil {
-		return nil, errors.New("failed to open uploaded file")
+		return err
 	}
-	defer src.Close()
 
-	// Create destination file
-	dst, err := os.Create(filePath)
+	reader, err := store.Get(ctx, key)
 	if err != nil {
-		return nil, errors.New("failed to create destination file")
+		return err
 	}
-	defer dst.Close()
+	defer reader.Close()
 
-	// Copy file content
-	if _, err := dst.ReadFrom(src); err != nil {
-		return nil, errors.New("failed to save file")
-	}
+	c.Header("Content-Type", mimeType)
+	c.Header("Content-Disposition", disposition)
 
-	// Save metadata in the database, excluding the extension
-	fileRecord := models.File{
-		Filename:     fileName,
-		OriginalName: file.Filename,
-		MimeType:     file.Header.Get("Content-Type"),
-		Path:         filePath,
-		Size:         file.Size,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", info.LastModified, seeker)
+		return nil
 	}
+	c.DataFromReader(http.StatusOK, info.Size, mimeType, reader, nil)
+	return nil
+}
 
-	if err := models.DB.Create(&fileRecord).Error; err != nil {
+// UploadFile stores a single uploaded file and saves its metadata
+func UploadFile(ctx context.Context, in UploadInput) (map[string]interface{}, error) {
+	fileRecord, err := Store(ctx, in)
+	if err != nil {
 		return nil, err
 	}
-
-	// Prepare the response with detailed metadata
-	response := map[string]interface{}{
-		"uri":          fileName,
-		"originalname": file.Filename,
-		"mimetype":     file.Header.Get("Content-Type"),
-		"size":         file.Size,
-	}
-
-	return response, nil
+	return FileResponse(fileRecord), nil
 }
 
 // UploadProductImage handles saving an image specifically for products
-func UploadProductImage(file *multipart.FileHeader) (map[string]interface{}, error) {
-	uploadFolder := "public/uploads"
-	if err := os.MkdirAll(uploadFolder, os.ModePerm); err != nil {
-		return nil, errors.New("failed to create upload directory")
-	}
-
-	// Generate a unique file name without extension
-	fileName := uuid.New().String() // Include extension
-	filePath := filepath.Join(uploadFolder, fileName)
-
-	// Open the uploaded file
-	src, err := file.Open()
+func UploadProductImage(ctx context.Context, in UploadInput) (map[string]interface{}, error) {
+	fileRecord, err := Store(ctx, in)
 	if err != nil {
-		return nil, errors.New("failed to open uploaded file")
+		return nil, err
 	}
-	defer src.Close()
+	return FileResponse(fileRecord), nil
+}
 
-	// Create destination file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return nil, errors.New("failed to create destination file")
+// PurgeFile permanently removes a file record with its versions and preset
+// derivatives and drops their blob references. A physical object is only
+// deleted when no other file or version shares the blob. Purging a file that
+// is already gone is a no-op.
+func PurgeFile(ctx context.Context, file *models.File) error {
+	var derivatives []models.File
+	if err := models.DB.Unscoped().Where("parent_id = ?", file.ID).Find(&derivatives).Error; err != nil {
+		return err
 	}
-	defer dst.Close()
-
-	// Copy file content
-	if _, err := dst.ReadFrom(src); err != nil {
-		return nil, errors.New("failed to save file")
+	for i := range derivatives {
+		if err := PurgeFile(ctx, &derivatives[i]); err != nil {
+			return err
+		}
 	}
 
-	// Save metadata in the database, excluding the extension
-	fileRecord := models.File{
-		Filename:     fileName,
-		OriginalName: file.Filename,
-		MimeType:     file.Header.Get("Content-Type"),
-		Path:         filePath,
-		Size:         file.Size,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
+	var orphans []*models.Blob
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", file.ID).Limit(1).Find(&models.File{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
 
-	if err := models.DB.Create(&fileRecord).Error; err != nil {
-		return nil, err
-	}
+		// Resumable uploads only point at the file they produced
+		if err := tx.Where("file_id = ?", file.ID).Delete(&models.TusUpload{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", file.ID).Delete(&models.FileTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", file.ID).Delete(&models.FileMeta{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", file.ID).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
 
-	// Prepare the response with detailed metadata
-	response := map[string]interface{}{
-		"uri":          fileName,
-		"originalname": file.Filename,
-		"mimetype":     file.Header.Get("Content-Type"),
-		"size":         file.Size,
-	}
+		var versions []models.FileVersion
+		if err := tx.Where("file_id = ?", file.ID).Find(&versions).Error; err != nil {
+			return err
+		}
+		var err error
+		if orphans, err = deleteVersions(tx, versions); err != nil {
+			return err
+		}
 
-	return response, nil
+		if err := tx.Unscoped().Delete(&models.File{}, file.ID).Error; err != nil {
+			return err
+		}
+		if file.BlobID == nil {
+			return nil
+		}
+		orphan, err := releaseBlob(tx, *file.BlobID)
+		if orphan != nil {
+			orphans = append(orphans, orphan)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return deleteBlobObjects(ctx, orphans)
 }
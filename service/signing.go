@@ -0,0 +1,172 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"my-project/config"
+	"my-project/models"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned when verifying a signed URL
+var (
+	ErrSigningDisabled  = errors.New("url signing secret is not configured")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signed url has expired")
+	ErrSignatureIP      = errors.New("signed url is bound to another ip address")
+)
+
+// DownloadGrant describes what a signed download URL allows
+type DownloadGrant struct {
+	Tenant      string
+	Filename    string
+	ExpiresAt   time.Time
+	Disposition string // "inline" or "attachment", empty to let the request decide
+	IP          string // client ip the url is bound to, empty when unbound
+	Version     int    // version of the file the url opens, 0 for the current content
+}
+
+// signature computes the HMAC of the canonical fields of a grant
+func signature(secret string, fields ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// downloadFields lists the signed fields of a download URL. The tenant,
+// version and transformation are only appended when present so URLs of
+// original files of the default tenant keep their signature.
+func downloadFields(tenant, filename, expires, disposition, ip string, version int, transform *Transform) []string {
+	fields := []string{"download", filename, expires, disposition, ip}
+	if tenant != "" {
+		fields = append(fields, "tenant="+tenant)
+	}
+	if version > 0 {
+		fields = append(fields, "version="+strconv.Itoa(version))
+	}
+	if transform != nil {
+		fields = append(fields, transform.Canonical())
+	}
+	return fields
+}
+
+// SignDownload issues the query parameters of a time limited download URL for
+// a file of tenant, or for one of its versions when version is set, optionally
+// for a transformed variant of an image. ttl is clamped to the configured
+// maximum and defaults when zero.
+func SignDownload(tenant, filename string, version int, ttl time.Duration, disposition, ip string, transform *Transform) (url.Values, *DownloadGrant, error) {
+	cfg := config.LoadSigningConfig()
+	if cfg.Secret == "" {
+		return nil, nil, ErrSigningDisabled
+	}
+	if ttl <= 0 {
+		ttl = cfg.DefaultTTL
+	}
+	if ttl > cfg.MaxTTL {
+		ttl = cfg.MaxTTL
+	}
+	if disposition != "" && disposition != "inline" && disposition != "attachment" {
+		return nil, nil, errors.New("disposition must be inline or attachment")
+	}
+
+	if version > 0 && transform != nil {
+		return nil, nil, errors.New("versions cannot be transformed")
+	}
+
+	// Only sign files and versions that exist so links cannot be minted for arbitrary names
+	var file models.File
+	if err := models.DB.Where("tenant = ? AND filename = ?", tenant, filename).First(&file).Error; err != nil {
+		return nil, nil, err
+	}
+	if version > 0 && version != file.Version {
+		if _, err := findVersion(models.DB, file.ID, version); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	grant := &DownloadGrant{
+		Tenant:      tenant,
+		Filename:    filename,
+		ExpiresAt:   time.Now().Add(ttl).Truncate(time.Second),
+		Disposition: disposition,
+		IP:          ip,
+		Version:     version,
+	}
+	expires := strconv.FormatInt(grant.ExpiresAt.Unix(), 10)
+
+	query := url.Values{}
+	if transform != nil {
+		query = transform.Query()
+	}
+	if tenant != "" {
+		query.Set("tenant", tenant)
+	}
+	query.Set("expires", expires)
+	if disposition != "" {
+		query.Set("disposition", disposition)
+	}
+	if ip != "" {
+		query.Set("ip", ip)
+	}
+	if version > 0 {
+		query.Set("version", strconv.Itoa(version))
+	}
+	query.Set("signature", signature(cfg.Secret, downloadFields(tenant, filename, expires, disposition, ip, version, transform)...))
+	return query, grant, nil
+}
+
+// VerifyDownload checks the signature, expiry and ip binding of a download URL,
+// including the tenant, version and transformation parameters it carries
+func VerifyDownload(filename string, query url.Values, clientIP string) (*DownloadGrant, error) {
+	cfg := config.LoadSigningConfig()
+	if cfg.Secret == "" {
+		return nil, ErrSigningDisabled
+	}
+
+	tenant := query.Get("tenant")
+	expires := query.Get("expires")
+	disposition := query.Get("disposition")
+	ip := query.Get("ip")
+	version := 0
+	if value := query.Get("version"); value != "" {
+		var err error
+		if version, err = strconv.Atoi(value); err != nil || version < 1 {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	transform, err := ParseTransform(query)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	expected := signature(cfg.Secret, downloadFields(tenant, filename, expires, disposition, ip, version, transform)...)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return nil, ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	grant := &DownloadGrant{
+		Tenant:      tenant,
+		Filename:    filename,
+		ExpiresAt:   time.Unix(unix, 0),
+		Disposition: disposition,
+		IP:          ip,
+		Version:     version,
+	}
+	if time.Now().After(grant.ExpiresAt) {
+		return nil, ErrSignatureExpired
+	}
+	if ip != "" && ip != clientIP {
+		return nil, ErrSignatureIP
+	}
+	return grant, nil
+}
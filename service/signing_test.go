@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedQuery builds the query of a download URL the way SignDownload does,
+// without looking the file up
+func signedQuery(secret, tenant, filename string, version int, expiresAt time.Time, disposition, ip string) url.Values {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{"expires": {expires}}
+	if tenant != "" {
+		query.Set("tenant", tenant)
+	}
+	if disposition != "" {
+		query.Set("disposition", disposition)
+	}
+	if ip != "" {
+		query.Set("ip", ip)
+	}
+	if version > 0 {
+		query.Set("version", strconv.Itoa(version))
+	}
+	query.Set("signature", signature(secret, downloadFields(tenant, filename, expires, disposition, ip, version, nil)...))
+	return query
+}
+
+func TestVerifyDownload(t *testing.T) {
+	t.Setenv("URL_SIGNING_SECRET", "secret")
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		filename string // verified filename, "a.png" when empty
+		query    url.Values
+		clientIP string
+		version  int // version the grant must open
+		want     error
+	}{
+		{
+			name:  "valid",
+			query: signedQuery("secret", "", "a.png", 0, future, "", ""),
+		},
+		{
+			name:  "valid for a tenant with a disposition",
+			query: signedQuery("secret", "acme", "a.png", 0, future, "attachment", ""),
+		},
+		{
+			name:     "valid from the bound ip",
+			query:    signedQuery("secret", "", "a.png", 0, future, "", "10.0.0.1"),
+			clientIP: "10.0.0.1",
+		},
+		{
+			name:     "another file",
+			filename: "b.png",
+			query:    signedQuery("secret", "", "a.png", 0, future, "", ""),
+			want:     ErrInvalidSignature,
+		},
+		{
+			name:  "another secret",
+			query: signedQuery("other", "", "a.png", 0, future, "", ""),
+			want:  ErrInvalidSignature,
+		},
+		{
+			name:  "expired",
+			query: signedQuery("secret", "", "a.png", 0, time.Now().Add(-time.Minute), "", ""),
+			want:  ErrSignatureExpired,
+		},
+		{
+			name:     "another ip",
+			query:    signedQuery("secret", "", "a.png", 0, future, "", "10.0.0.1"),
+			clientIP: "10.0.0.2",
+			want:     ErrSignatureIP,
+		},
+		{
+			name: "extended expiry",
+			query: func() url.Values {
+				query := signedQuery("secret", "", "a.png", 0, future, "", "")
+				query.Set("expires", strconv.FormatInt(future.Add(time.Hour).Unix(), 10))
+				return query
+			}(),
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "dropped ip binding",
+			query: func() url.Values {
+				query := signedQuery("secret", "", "a.png", 0, future, "", "10.0.0.1")
+				query.Del("ip")
+				return query
+			}(),
+			clientIP: "10.0.0.2",
+			want:     ErrInvalidSignature,
+		},
+		{
+			name: "changed disposition",
+			query: func() url.Values {
+				query := signedQuery("secret", "", "a.png", 0, future, "inline", "")
+				query.Set("disposition", "attachment")
+				return query
+			}(),
+			want: ErrInvalidSignature,
+		},
+		{
+			name:    "valid for a version",
+			query:   signedQuery("secret", "", "a.png", 2, future, "", ""),
+			version: 2,
+		},
+		{
+			name: "another version",
+			query: func() url.Values {
+				query := signedQuery("secret", "", "a.png", 2, future, "", "")
+				query.Set("version", "1")
+				return query
+			}(),
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "version added",
+			query: func() url.Values {
+				query := signedQuery("secret", "", "a.png", 0, future, "", "")
+				query.Set("version", "1")
+				return query
+			}(),
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "version dropped",
+			query: func() url.Values {
+				query := signedQuery("secret", "", "a.png", 2, future, "", "")
+				query.Del("version")
+				return query
+			}(),
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "added transformation",
+			query: func() url.Values {
+				query := signedQuery("secret", "", "a.png", 0, future, "", "")
+				query.Set("w", "100")
+				return query
+			}(),
+			want: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := tt.filename
+			if filename == "" {
+				filename = "a.png"
+			}
+			grant, err := VerifyDownload(filename, tt.query, tt.clientIP)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyDownload() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && (grant.Filename != filename || grant.Tenant != tt.query.Get("tenant") || grant.Version != tt.version) {
+				t.Errorf("VerifyDownload() = %+v, want a grant for %s", grant, filename)
+			}
+		})
+	}
+}
+
+func TestVerifyDownloadDisabled(t *testing.T) {
+	t.Setenv("URL_SIGNING_SECRET", "")
+	query := signedQuery("", "", "a.png", 0, time.Now().Add(time.Hour), "", "")
+	if _, err := VerifyDownload("a.png", query, ""); !errors.Is(err, ErrSigningDisabled) {
+		t.Fatalf("VerifyDownload() error = %v, want %v", err, ErrSigningDisabled)
+	}
+}
+
+func TestVerifyUploadPolicy(t *testing.T) {
+	t.Setenv("URL_SIGNING_SECRET", "secret")
+	encoded, sig, err := SignUploadPolicy(UploadPolicy{
+		Expiration: time.Now().Add(time.Hour),
+		Folder:     "photos",
+		MaxSize:    1024,
+	})
+	if err != nil {
+		t.Fatalf("SignUploadPolicy() error = %v", err)
+	}
+	expired, expiredSig, err := SignUploadPolicy(UploadPolicy{Expiration: time.Now().Add(-time.Minute), MaxSize: 1})
+	if err != nil {
+		t.Fatalf("SignUploadPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		sig     string
+		want    error
+	}{
+		{name: "valid", encoded: encoded, sig: sig},
+		{name: "tampered policy", encoded: encoded + "A", sig: sig, want: ErrInvalidSignature},
+		{name: "tampered signature", encoded: encoded, sig: sig[1:], want: ErrInvalidSignature},
+		{name: "expired", encoded: expired, sig: expiredSig, want: ErrPolicyExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := VerifyUploadPolicy(tt.encoded, tt.sig)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyUploadPolicy() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && (policy.Folder != "photos" || policy.MaxSize != 1024) {
+				t.Errorf("VerifyUploadPolicy() = %+v, want the signed policy", policy)
+			}
+		})
+	}
+}
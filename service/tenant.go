@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+	"path"
+	"regexp"
+)
+
+// ErrInvalidTenant is returned for tenant ids that cannot be used as a storage prefix
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+// tenantPattern restricts tenant ids to characters safe in storage keys
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// tenantPrefix holds the storage keys of every tenant but the default one
+const tenantPrefix = "tenants"
+
+// CheckTenant validates a tenant id. The empty id is the default tenant.
+func CheckTenant(tenant string) error {
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+// tenantKey places a storage key below the prefix of its tenant. The
+// default tenant keeps the unprefixed layout of single tenant installs.
+func tenantKey(tenant, key string) string {
+	if tenant == "" {
+		return key
+	}
+	return path.Join(tenantPrefix, tenant, key)
+}
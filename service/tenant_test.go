@@ -0,0 +1,117 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckTenant(t *testing.T) {
+	tests := []struct {
+		tenant string
+		want   error
+	}{
+		{tenant: ""},
+		{tenant: "acme"},
+		{tenant: "Acme_42-eu"},
+		{tenant: "../acme", want: ErrInvalidTenant},
+		{tenant: "acme/eu", want: ErrInvalidTenant},
+		{tenant: "acme eu", want: ErrInvalidTenant},
+		{tenant: strings.Repeat("a", 64)},
+		{tenant: strings.Repeat("a", 65), want: ErrInvalidTenant},
+	}
+	for _, tt := range tests {
+		if err := CheckTenant(tt.tenant); !errors.Is(err, tt.want) {
+			t.Errorf("CheckTenant(%q) = %v, want %v", tt.tenant, err, tt.want)
+		}
+	}
+}
+
+func TestTenantKeys(t *testing.T) {
+	hash := "abcdef0123456789"
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "default tenant key", got: tenantKey("", "uploads/a.png"), want: "uploads/a.png"},
+		{name: "tenant key", got: tenantKey("acme", "uploads/a.png"), want: "tenants/acme/uploads/a.png"},
+		{name: "default tenant blob", got: blobKey("", hash), want: "blobs/ab/cd/" + hash},
+		{name: "tenant blob", got: blobKey("acme", hash), want: "tenants/acme/blobs/ab/cd/" + hash},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSignedDownloadTenant(t *testing.T) {
+	t.Setenv("URL_SIGNING_SECRET", "secret")
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		signed string // tenant the url was signed for
+		tenant string // tenant the url claims
+		want   error
+	}{
+		{name: "same tenant", signed: "acme", tenant: "acme"},
+		{name: "another tenant", signed: "acme", tenant: "globex", want: ErrInvalidSignature},
+		{name: "default tenant claimed", signed: "acme", want: ErrInvalidSignature},
+		{name: "tenant added", tenant: "acme", want: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := signedQuery("secret", tt.signed, "a.png", 0, future, "", "")
+			if tt.tenant == "" {
+				query.Del("tenant")
+			} else {
+				query.Set("tenant", tt.tenant)
+			}
+			if _, err := VerifyDownload("a.png", query, ""); !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyDownload() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateJWTTenant(t *testing.T) {
+	t.Setenv("JWT_HS256_SECRET", "jwt-secret")
+	t.Setenv("JWT_ISSUER", "")
+	t.Setenv("JWT_AUDIENCE", "")
+
+	tests := []struct {
+		name   string
+		tenant interface{} // tenant claim, nil to leave it out
+		want   string
+		err    error
+	}{
+		{name: "tenant claim", tenant: "acme", want: "acme"},
+		{name: "no tenant claim"},
+		{name: "invalid tenant", tenant: "../acme", err: ErrInvalidToken},
+		{name: "tenant of another type", tenant: 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+			if tt.tenant != nil {
+				claims["tenant"] = tt.tenant
+			}
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("jwt-secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			principal, err := AuthenticateJWT(token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("AuthenticateJWT() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && principal.Tenant != tt.want {
+				t.Errorf("AuthenticateJWT() tenant = %q, want %q", principal.Tenant, tt.want)
+			}
+		})
+	}
+}
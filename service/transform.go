@@ -0,0 +1,363 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"my-project/config"
+	"my-project/storage"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+)
+
+// derivativePrefix holds transformed variants, grouped by the hash of their source
+const derivativePrefix = "derivatives"
+
+// Errors returned for image transformations
+var (
+	ErrInvalidTransform = errors.New("invalid transform")
+	ErrNotTransformable = errors.New("file is not a transformable image")
+	ErrImageTooLarge    = errors.New("source image is too large to transform")
+)
+
+// transformParams are the query parameters that request a transformation
+var transformParams = []string{"w", "h", "fit", "crop", "format", "quality"}
+
+// Transform describes a resized or re-encoded variant of an image
+type Transform struct {
+	Width   int    // 0 keeps the aspect ratio from Height
+	Height  int    // 0 keeps the aspect ratio from Width
+	Fit     string // "contain" scales within the box, "cover" fills it and crops the overflow
+	Crop    image.Rectangle
+	Format  string // "jpeg", "png" or "gif", empty for the format of the source
+	Quality int    // JPEG quality, 0 for the default
+
+	shrinkOnly bool // never scale the source up, used by presets
+}
+
+// ParseTransform reads the transformation parameters of a query. It returns
+// nil when the query asks for the original file.
+func ParseTransform(query url.Values) (*Transform, error) {
+	requested := false
+	for _, param := range transformParams {
+		requested = requested || query.Get(param) != ""
+	}
+	if !requested {
+		return nil, nil
+	}
+
+	cfg := config.LoadTransformConfig()
+	t := &Transform{Fit: "contain"}
+	var err error
+	if t.Width, err = dimensionParam(query, "w", cfg.MaxDimension); err != nil {
+		return nil, err
+	}
+	if t.Height, err = dimensionParam(query, "h", cfg.MaxDimension); err != nil {
+		return nil, err
+	}
+
+	switch fit := query.Get("fit"); fit {
+	case "", "contain":
+	case "cover":
+		t.Fit = fit
+	default:
+		return nil, fmt.Errorf("%w: fit must be contain or cover", ErrInvalidTransform)
+	}
+
+	if crop := query.Get("crop"); crop != "" {
+		parts := strings.Split(crop, ",")
+		values := make([]int, 0, 4)
+		for _, part := range parts {
+			value, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || value < 0 {
+				break
+			}
+			values = append(values, value)
+		}
+		if len(parts) != 4 || len(values) != 4 || values[2] == 0 || values[3] == 0 {
+			return nil, fmt.Errorf("%w: crop must be x,y,width,height", ErrInvalidTransform)
+		}
+		t.Crop = image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3])
+	}
+
+	switch format := query.Get("format"); format {
+	case "":
+	case "jpeg", "jpg":
+		t.Format = "jpeg"
+	case "png", "gif":
+		t.Format = format
+	default:
+		return nil, fmt.Errorf("%w: format must be jpeg, png or gif", ErrInvalidTransform)
+	}
+
+	if quality := query.Get("quality"); quality != "" {
+		t.Quality, err = strconv.Atoi(quality)
+		if err != nil || t.Quality < 1 || t.Quality > 100 {
+			return nil, fmt.Errorf("%w: quality must be between 1 and 100", ErrInvalidTransform)
+		}
+	}
+	return t, nil
+}
+
+// dimensionParam parses a width or height parameter
+func dimensionParam(query url.Values, name string, max int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%w: %s must be between 1 and %d", ErrInvalidTransform, name, max)
+	}
+	return n, nil
+}
+
+// Query returns the normalized parameters of the transformation
+func (t *Transform) Query() url.Values {
+	query := url.Values{}
+	if t.Width > 0 {
+		query.Set("w", strconv.Itoa(t.Width))
+	}
+	if t.Height > 0 {
+		query.Set("h", strconv.Itoa(t.Height))
+	}
+	if t.Fit != "contain" {
+		query.Set("fit", t.Fit)
+	}
+	if !t.Crop.Empty() {
+		query.Set("crop", fmt.Sprintf("%d,%d,%d,%d", t.Crop.Min.X, t.Crop.Min.Y, t.Crop.Dx(), t.Crop.Dy()))
+	}
+	if t.Format != "" {
+		query.Set("format", t.Format)
+	}
+	if t.Quality > 0 {
+		query.Set("quality", strconv.Itoa(t.Quality))
+	}
+	return query
+}
+
+// Canonical is the stable text form of the transformation used for signing and caching
+func (t *Transform) Canonical() string {
+	return t.Query().Encode()
+}
+
+// sourceFormat maps the mime type of a file to the image format it is decoded from
+func sourceFormat(mimeType string) string {
+	switch baseType(mimeType) {
+	case "image/jpeg":
+		return "jpeg"
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		// WebP can be decoded but not encoded in pure Go
+		return "png"
+	}
+	return ""
+}
+
+// derivativeKey locates the cached variant of a source of tenant for a transformation
+func derivativeKey(tenant, sourceHash, canonical, format string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return derivativeDir(tenant, sourceHash) + hex.EncodeToString(sum[:16]) + "." + format
+}
+
+// derivativeDir is the prefix holding every cached variant of a source
+func derivativeDir(tenant, sourceHash string) string {
+	return tenantKey(tenant, path.Join(derivativePrefix, sourceHash[0:2], sourceHash[2:4], sourceHash)) + "/"
+}
+
+// ReadTransformed serves a transformed variant of an image of tenant,
+// rendering it on the first request and reusing the cached derivative afterwards
+func ReadTransformed(tenant, filename string, t *Transform, download bool, c *gin.Context) error {
+	file, err := findFile(tenant, filename, false)
+	if err != nil {
+		return err
+	}
+	format := t.Format
+	if sourceFormat(file.MimeType) == "" || len(file.Hash) < 4 {
+		return ErrNotTransformable
+	}
+	if format == "" {
+		format = sourceFormat(file.MimeType)
+	}
+
+	mimeType := "image/" + format
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+	disposition += "; filename=" + strings.TrimSuffix(file.OriginalName, path.Ext(file.OriginalName)) + "." + format
+
+	store, err := storage.Disk(file.Disk)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request.Context()
+	key := derivativeKey(file.Tenant, file.Hash, t.Canonical(), format)
+	if _, err := store.Stat(ctx, key); err == nil {
+		return serveObject(c, file.Disk, key, mimeType, disposition)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	source, err := store.Get(ctx, file.Path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	var rendered bytes.Buffer
+	if err := renderTransform(source, t, format, &rendered); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, key, bytes.NewReader(rendered.Bytes()), int64(rendered.Len()), mimeType); err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", mimeType)
+	c.Header("Content-Disposition", disposition)
+	http.ServeContent(c.Writer, c.Request, "", time.Now(), bytes.NewReader(rendered.Bytes()))
+	return nil
+}
+
+// renderTransform decodes an image, applies t and encodes the result as format
+func renderTransform(r io.Reader, t *Transform, format string, w io.Writer) error {
+	cfg := config.LoadTransformConfig()
+
+	// Check the dimensions before decoding so huge images are not loaded in memory
+	buffered := bufio.NewReaderSize(r, headLen)
+	head, err := buffered.Peek(headLen)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	header, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return ErrImageUnreadable
+	}
+	if int64(header.Width)*int64(header.Height) > cfg.MaxPixels {
+		return ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(buffered)
+	if err != nil {
+		return ErrImageUnreadable
+	}
+	dst, err := t.apply(src, format == "jpeg")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "jpeg":
+		quality := t.Quality
+		if quality == 0 {
+			quality = cfg.DefaultQuality
+		}
+		return jpeg.Encode(w, dst, &jpeg.Options{Quality: quality})
+	case "gif":
+		return gif.Encode(w, dst, nil)
+	default:
+		return png.Encode(w, dst)
+	}
+}
+
+// apply crops and scales src. Transparent areas are flattened on white when
+// the target format has no alpha channel.
+func (t *Transform) apply(src image.Image, opaque bool) (image.Image, error) {
+	bounds := src.Bounds()
+	if !t.Crop.Empty() {
+		bounds = t.Crop.Add(bounds.Min).Intersect(bounds)
+		if bounds.Empty() {
+			return nil, fmt.Errorf("%w: crop is outside of the image", ErrInvalidTransform)
+		}
+	}
+
+	// Pick the source area and output size for the requested box
+	sw, sh := float64(bounds.Dx()), float64(bounds.Dy())
+	width, height := t.Width, t.Height
+	switch {
+	case width > 0 && height > 0 && t.Fit == "cover":
+		scale := math.Max(float64(width)/sw, float64(height)/sh)
+		cw, ch := int(math.Round(float64(width)/scale)), int(math.Round(float64(height)/scale))
+		x := bounds.Min.X + (bounds.Dx()-cw)/2
+		y := bounds.Min.Y + (bounds.Dy()-ch)/2
+		bounds = image.Rect(x, y, x+cw, y+ch)
+		if t.shrinkOnly && scale > 1 {
+			width, height = cw, ch
+		}
+	case width > 0 && height > 0:
+		scale := t.limitScale(math.Min(float64(width)/sw, float64(height)/sh))
+		width, height = scaled(sw, scale), scaled(sh, scale)
+	case width > 0:
+		scale := t.limitScale(float64(width) / sw)
+		width, height = scaled(sw, scale), scaled(sh, scale)
+	case height > 0:
+		scale := t.limitScale(float64(height) / sh)
+		width, height = scaled(sw, scale), scaled(sh, scale)
+	default:
+		width, height = bounds.Dx(), bounds.Dy()
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	op := draw.Src
+	if opaque {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		op = draw.Over
+	}
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, op)
+	} else {
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, op, nil)
+	}
+	return dst, nil
+}
+
+// limitScale caps the scale factor at 1 for shrink only transformations
+func (t *Transform) limitScale(scale float64) float64 {
+	if t.shrinkOnly && scale > 1 {
+		return 1
+	}
+	return scale
+}
+
+// scaled multiplies a dimension, never going below one pixel
+func scaled(size, scale float64) int {
+	return int(math.Max(1, math.Round(size*scale)))
+}
+
+// deleteDerivatives removes every cached variant of a source of tenant
+func deleteDerivatives(ctx context.Context, store storage.Storage, tenant, sourceHash string) error {
+	if len(sourceHash) < 4 {
+		return nil
+	}
+	objects, err := store.List(ctx, derivativeDir(tenant, sourceHash))
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := store.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"my-project/config"
+	"my-project/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrFileNotFound is returned when no file matches a filename
+var ErrFileNotFound = errors.New("file not found")
+
+// findFile loads a file of tenant by filename, including trashed ones when
+// unscoped is set. Files of other tenants are reported as not found.
+func findFile(tenant, filename string, unscoped bool) (*models.File, error) {
+	db := models.DB
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var file models.File
+	err := withDetails(db).Where("tenant = ? AND filename = ?", tenant, filename).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// TrashFile soft deletes a file and its preset derivatives so they are hidden
+// from ReadFile and listings until restored or purged
+func TrashFile(tenant, filename string) error {
+	file, err := findFile(tenant, filename, false)
+	if err != nil {
+		return err
+	}
+	return models.DB.Where("id = ? OR parent_id = ?", file.ID, file.ID).Delete(&models.File{}).Error
+}
+
+// RestoreFile brings a trashed file back with its preset derivatives,
+// recreating its folder when it was deleted in the meantime
+func RestoreFile(tenant, filename string) (*models.File, error) {
+	file, err := findFile(tenant, filename, true)
+	if err != nil {
+		return nil, err
+	}
+	if !file.DeletedAt.Valid {
+		return file, nil
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		folder, err := ensureFolder(tx, file.Tenant, file.Folder, file.OwnerID)
+		if err != nil {
+			return err
+		}
+		file.FolderID = folderID(folder)
+		return tx.Unscoped().Model(&models.File{}).Where("id = ? OR parent_id = ?", file.ID, file.ID).
+			Updates(map[string]interface{}{"deleted_at": nil, "folder_id": file.FolderID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	file.DeletedAt = gorm.DeletedAt{}
+	return file, nil
+}
+
+// PurgeTrashedFile permanently removes a trashed file and its physical object
+// when no other file shares it. Live files must go through the trash first.
+func PurgeTrashedFile(ctx context.Context, tenant, filename string) error {
+	file, err := findFile(tenant, filename, true)
+	if err != nil {
+		return err
+	}
+	if !file.DeletedAt.Valid {
+		return ErrFileNotFound
+	}
+	return PurgeFile(ctx, file)
+}
+
+// SweepTrash purges every file that has been in the trash longer than
+// retention. A file that fails is logged and left for the next sweep, the
+// errors are returned together once the others are purged.
+func SweepTrash(ctx context.Context, retention time.Duration) (int, error) {
+	var expired []models.File
+	cutoff := time.Now().Add(-retention)
+	if err := models.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var errs []error
+	for i := range expired {
+		if err := PurgeFile(ctx, &expired[i]); err != nil {
+			log.Printf("⚠️ Failed to purge %s from the trash: %v", expired[i].Filename, err)
+			errs = append(errs, fmt.Errorf("%s: %w", expired[i].Filename, err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// StartTrashSweeper periodically purges expired trash and deletes idle tus
+// uploads in the background
+func StartTrashSweeper(ctx context.Context, cfg config.TrashConfig, tus config.TusConfig) {
+	if cfg.SweepInterval <= 0 || (cfg.Retention <= 0 && tus.Expiration <= 0) {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.SweepInterval)
+		defer ticker.Stop()
+		for {
+			if cfg.Retention > 0 {
+				purged, err := SweepTrash(ctx, cfg.Retention)
+				if err != nil {
+					log.Println("⚠️ Trash sweep failed:", err)
+				}
+				if purged > 0 {
+					log.Printf("🧹 Purged %d expired files from the trash", purged)
+				}
+			}
+			if tus.Expiration > 0 {
+				expired, err := ExpireTusUploads(tus.Expiration)
+				if err != nil {
+					log.Println("⚠️ Tus upload expiry failed:", err)
+				}
+				if expired > 0 {
+					log.Printf("🧹 Deleted %d idle tus uploads", expired)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
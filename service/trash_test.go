@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"my-project/models"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// testDB points models.DB at a migrated in-memory database for one test
+func testDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(models.Models()...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	previous := models.DB
+	models.DB = db
+	t.Cleanup(func() {
+		models.DB = previous
+		sqlDB.Close()
+	})
+}
+
+func TestPurgeTrashedFileLive(t *testing.T) {
+	testDB(t)
+	file := models.File{Filename: "a.png", OriginalName: "a.png", MimeType: "image/png", Path: "uploads/a.png", Size: 1}
+	if err := models.DB.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PurgeTrashedFile(context.Background(), "", "a.png"); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("PurgeTrashedFile() error = %v, want %v", err, ErrFileNotFound)
+	}
+	var count int64
+	models.DB.Model(&models.File{}).Where("filename = ?", "a.png").Count(&count)
+	if count != 1 {
+		t.Errorf("live file purged, %d rows left", count)
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"my-project/config"
+	"my-project/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Errors returned by the tus service, mapped to status codes by the controller
+var (
+	ErrTusNotFound       = errors.New("upload not found")
+	ErrTusOffsetMismatch = errors.New("upload offset does not match")
+	ErrTusTooLarge       = errors.New("upload exceeds the maximum size")
+	ErrTusCompleted      = errors.New("upload is already complete")
+)
+
+// tusLocks serializes PATCH requests for the same upload
+var tusLocks sync.Map
+
+func lockTusUpload(id string) func() {
+	value, _ := tusLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// tusPartPath returns the local file holding the bytes received so far
+func tusPartPath(id string) string {
+	return filepath.Join(config.LoadTusConfig().UploadDir, id)
+}
+
+// ParseTusMetadata decodes an Upload-Metadata header ("key base64value,key2 ...")
+func ParseTusMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		value := ""
+		if len(fields) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata
+}
+
+// CreateTusUpload registers a new resumable upload of the given length. The
+// size limits of in are checked against the declared length, the rest of its
+// policy applies when the upload is finalized.
+func CreateTusUpload(length int64, metadata string, in UploadInput) (*models.TusUpload, error) {
+	if length > config.LoadTusConfig().MaxSize {
+		return nil, ErrTusTooLarge
+	}
+	if in.MaxSize > 0 && length > in.MaxSize {
+		return nil, ErrFileTooLarge
+	}
+	if length < in.MinSize {
+		return nil, ErrFileTooSmall
+	}
+	if err := checkFolderPath(CleanFolder(in.Folder)); err != nil {
+		return nil, err
+	}
+	if _, err := fileVisibility(ParseTusMetadata(metadata)["visibility"]); err != nil {
+		return nil, err
+	}
+
+	upload := models.TusUpload{
+		ID:         uuid.New().String(),
+		Tenant:     in.Tenant,
+		Length:     length,
+		Metadata:   metadata,
+		UploadedBy: in.UploadedBy,
+	}
+
+	dir := config.LoadTusConfig().UploadDir
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.New("failed to create upload directory")
+	}
+	part, err := os.Create(tusPartPath(upload.ID))
+	if err != nil {
+		return nil, errors.New("failed to create upload file")
+	}
+	part.Close()
+
+	if err := models.DB.Create(&upload).Error; err != nil {
+		os.Remove(tusPartPath(upload.ID))
+		return nil, err
+	}
+
+	// An empty upload is complete as soon as it is created
+	if length == 0 {
+		return &upload, finalizeTusUpload(context.Background(), &upload, in)
+	}
+	return &upload, nil
+}
+
+// GetTusUpload loads an upload of tenant together with the file it produced, if any
+func GetTusUpload(tenant, id string) (*models.TusUpload, error) {
+	var upload models.TusUpload
+	err := models.DB.Preload("File").Where("tenant = ? AND id = ?", tenant, id).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTusNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// AppendTusUpload writes a chunk at offset and finalizes the upload into a
+// File record once every byte has been received. Bytes received before a
+// dropped connection are kept so the client can resume from the new offset.
+// in carries the policy the finalized upload is stored with.
+func AppendTusUpload(ctx context.Context, tenant, id string, offset int64, body io.Reader, in UploadInput) (*models.TusUpload, error) {
+	unlock := lockTusUpload(id)
+	defer unlock()
+
+	upload, err := GetTusUpload(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.FileID != nil {
+		return nil, ErrTusCompleted
+	}
+	if upload.Offset != offset {
+		return nil, ErrTusOffsetMismatch
+	}
+
+	part, err := os.OpenFile(tusPartPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.New("failed to open upload file")
+	}
+	// Drop anything written past the recorded offset by an interrupted request
+	if err := part.Truncate(offset); err != nil {
+		part.Close()
+		return nil, err
+	}
+	if _, err := part.Seek(offset, io.SeekStart); err != nil {
+		part.Close()
+		return nil, err
+	}
+
+	// Read one byte past the remaining length to detect oversized chunks
+	remaining := upload.Length - offset
+	written, copyErr := io.Copy(part, io.LimitReader(body, remaining+1))
+	if written > remaining {
+		part.Truncate(offset)
+		part.Close()
+		return nil, ErrTusTooLarge
+	}
+	if err := part.Close(); err != nil {
+		return nil, err
+	}
+
+	upload.Offset += written
+	if err := models.DB.Model(upload).Update("upload_offset", upload.Offset).Error; err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return upload, copyErr
+	}
+
+	if upload.Offset == upload.Length {
+		if err := finalizeTusUpload(ctx, upload, in); err != nil {
+			return nil, err
+		}
+		// Later requests only read the finished upload
+		tusLocks.Delete(id)
+	}
+	return upload, nil
+}
+
+// FinishTusUpload retries storing an upload of tenant whose bytes have all
+// been received but whose finalize failed, so clients resuming with a HEAD
+// request get the file or the reason it was refused. Other uploads are
+// returned as they are.
+func FinishTusUpload(ctx context.Context, tenant, id string, in UploadInput) (*models.TusUpload, error) {
+	unlock := lockTusUpload(id)
+	defer unlock()
+
+	upload, err := GetTusUpload(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.FileID != nil || upload.Offset != upload.Length {
+		return upload, nil
+	}
+	if err := finalizeTusUpload(ctx, upload, in); err != nil {
+		return nil, err
+	}
+	tusLocks.Delete(id)
+	return upload, nil
+}
+
+// finalizeTusUpload stores the assembled upload through the regular upload
+// path, with the policy of in and the name and type sent as metadata
+func finalizeTusUpload(ctx context.Context, upload *models.TusUpload, in UploadInput) error {
+	part, err := os.Open(tusPartPath(upload.ID))
+	if err != nil {
+		return errors.New("failed to open upload file")
+	}
+	defer part.Close()
+
+	metadata := ParseTusMetadata(upload.Metadata)
+	in.MimeType = metadata["filetype"]
+	if in.MimeType == "" {
+		in.MimeType = metadata["contentType"]
+	}
+	in.OriginalName = metadata["filename"]
+	if in.OriginalName == "" {
+		in.OriginalName = metadata["name"]
+	}
+	if in.OriginalName == "" {
+		in.OriginalName = upload.ID
+	}
+	in.Reader = part
+	in.Size = upload.Length
+	in.UploadedBy = upload.UploadedBy
+	in.Tenant = upload.Tenant
+	in.Visibility = metadata["visibility"]
+
+	file, err := Store(ctx, in)
+	if err != nil {
+		return err
+	}
+
+	upload.FileID = &file.ID
+	upload.File = file
+	if err := models.DB.Model(upload).Update("file_id", file.ID).Error; err != nil {
+		return err
+	}
+	os.Remove(tusPartPath(upload.ID))
+	return nil
+}
+
+// TerminateTusUpload deletes an upload of tenant and the bytes received so far
+func TerminateTusUpload(tenant, id string) error {
+	unlock := lockTusUpload(id)
+	defer unlock()
+	defer tusLocks.Delete(id)
+
+	upload, err := GetTusUpload(tenant, id)
+	if err != nil {
+		return err
+	}
+	if err := models.DB.Delete(upload).Error; err != nil {
+		return err
+	}
+	os.Remove(tusPartPath(id))
+	return nil
+}
+
+// ExpireTusUploads deletes the uploads left idle longer than expiration with
+// the bytes received so far, whether they were finished or not. Uploads
+// receiving a chunk are skipped until the next sweep.
+func ExpireTusUploads(expiration time.Duration) (int, error) {
+	cutoff := time.Now().Add(-expiration)
+	var ids []string
+	if err := models.DB.Model(&models.TusUpload{}).Where("updated_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	var errs []error
+	for _, id := range ids {
+		deleted, err := expireTusUpload(id, cutoff)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+		if deleted {
+			expired++
+		}
+	}
+	return expired, errors.Join(errs...)
+}
+
+// expireTusUpload deletes an upload and its lock unless a request holds the
+// lock or the upload was updated after cutoff
+func expireTusUpload(id string, cutoff time.Time) (bool, error) {
+	value, _ := tusLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	if !mu.TryLock() {
+		return false, nil
+	}
+	defer mu.Unlock()
+
+	result := models.DB.Where("id = ? AND updated_at < ?", id, cutoff).Delete(&models.TusUpload{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	tusLocks.Delete(id)
+	if err := os.Remove(tusPartPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return true, err
+	}
+	return true, nil
+}
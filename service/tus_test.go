@@ -0,0 +1,58 @@
+package service
+
+import (
+	"my-project/models"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpireTusUploads(t *testing.T) {
+	testDB(t)
+	t.Setenv("TUS_UPLOAD_DIR", t.TempDir())
+	stale := time.Now().Add(-2 * time.Hour)
+	fileID := uint(1)
+	uploads := []models.TusUpload{
+		{ID: "stale", Length: 10, Offset: 4, UpdatedAt: stale},
+		{ID: "finished", Length: 10, Offset: 10, FileID: &fileID, UpdatedAt: stale},
+		{ID: "busy", Length: 10, Offset: 4, UpdatedAt: stale},
+		{ID: "active", Length: 10, Offset: 4},
+	}
+	for _, upload := range uploads {
+		if err := models.DB.Create(&upload).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(tusPartPath(upload.ID), []byte("part"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tusLocks.Store(upload.ID, &sync.Mutex{})
+	}
+	t.Cleanup(func() {
+		for _, upload := range uploads {
+			tusLocks.Delete(upload.ID)
+		}
+	})
+	unlock := lockTusUpload("busy")
+	defer unlock()
+
+	expired, err := ExpireTusUploads(time.Hour)
+	if err != nil {
+		t.Fatalf("ExpireTusUploads() error = %v", err)
+	}
+	if expired != 2 {
+		t.Errorf("ExpireTusUploads() = %d, want 2", expired)
+	}
+	for _, tt := range []struct {
+		id   string
+		kept bool
+	}{{"stale", false}, {"finished", false}, {"busy", true}, {"active", true}} {
+		var count int64
+		models.DB.Model(&models.TusUpload{}).Where("id = ?", tt.id).Count(&count)
+		_, statErr := os.Stat(tusPartPath(tt.id))
+		_, locked := tusLocks.Load(tt.id)
+		if kept := count == 1; kept != tt.kept || (statErr == nil) != tt.kept || locked != tt.kept {
+			t.Errorf("%s: row %v, part file %v, lock %v, want all %v", tt.id, kept, statErr == nil, locked, tt.kept)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"my-project/config"
+	"my-project/models"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm"
+)
+
+// Errors returned when an upload violates its limits
+var (
+	ErrFileTooLarge    = errors.New("file exceeds the maximum allowed size")
+	ErrFileTooSmall    = errors.New("file is smaller than the minimum allowed size")
+	ErrRequestTooLarge = errors.New("request body exceeds the maximum allowed size")
+	ErrImageDimensions = errors.New("image dimensions are out of bounds")
+	ErrImageUnreadable = errors.New("image dimensions could not be read")
+)
+
+// sniffLen is the number of leading bytes inspected to detect the content type
+const sniffLen = 3072
+
+// headLen is the number of leading bytes buffered to read image headers,
+// large enough to skip the EXIF segment that precedes a JPEG frame header
+const headLen = 64 * 1024
+
+// UploadInput describes the content and metadata of a file being stored
+type UploadInput struct {
+	Reader       io.Reader
+	OriginalName string
+	MimeType     string // declared by the client, checked against the content
+	Size         int64  // -1 when unknown
+	Folder       string
+	MaxSize      int64 // enforced while streaming, 0 for no limit
+	MinSize      int64
+	AllowedTypes []string // mime patterns the detected type must match, empty for any
+	Tags         []string
+	Metadata     map[string]string // custom key/value pairs
+	Presets      []string          // image presets rendered once the file is stored
+	// StripMetadata removes EXIF, GPS and text metadata from JPEG and PNG
+	// images and rotates photos upright; ExifFields are recorded first
+	StripMetadata bool
+	ExifFields    []string // "camera" and "taken_at"
+	UploadedBy    string   // subject of the authenticated uploader
+	Tenant        string   // tenant the file belongs to, empty for the default one
+	Visibility    string   // private or public, empty for FILE_DEFAULT_VISIBILITY
+	// Image dimension bounds in pixels, 0 to skip
+	MinWidth  int
+	MaxWidth  int
+	MinHeight int
+	MaxHeight int
+}
+
+// checkDimensions reports whether any image dimension bound is set
+func (in UploadInput) checkDimensions() bool {
+	return in.MinWidth > 0 || in.MaxWidth > 0 || in.MinHeight > 0 || in.MaxHeight > 0
+}
+
+// pendingUpload is content staged on disk whose record has not been committed yet
+type pendingUpload struct {
+	staged  *stagedBlob
+	record  models.File
+	presets []string
+}
+
+// prepare streams the content to the staging area of the default disk,
+// enforcing size limits mid-stream so oversized uploads fail without being
+// written completely
+func prepare(ctx context.Context, in UploadInput) (*pendingUpload, error) {
+	if in.MaxSize > 0 && in.Size > in.MaxSize {
+		return nil, ErrFileTooLarge
+	}
+	if err := checkFolderPath(CleanFolder(in.Folder)); err != nil {
+		return nil, err
+	}
+	visibility, err := fileVisibility(in.Visibility)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := NormalizeTags(in.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMetadata(in.Metadata); err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReaderSize(in.Reader, headLen)
+	reader := io.Reader(buffered)
+	if in.MaxSize > 0 {
+		reader = &maxSizeReader{r: buffered, remaining: in.MaxSize}
+	}
+
+	// Detect the real type from the leading bytes instead of trusting the client
+	head, err := buffered.Peek(headLen)
+	if err != nil && err != io.EOF {
+		return nil, uploadReadError(err)
+	}
+	detected := DetectMimeType(head)
+	if err := checkContentType(in.OriginalName, in.MimeType, detected); err != nil {
+		return nil, err
+	}
+	if len(in.AllowedTypes) > 0 && !MatchMimeType(in.AllowedTypes, detected.String()) {
+		return nil, fmt.Errorf("%w: %s", ErrTypeNotAllowed, baseType(detected.String()))
+	}
+
+	// Clean images before anything is stored, keeping the requested EXIF fields
+	size, metadata := in.Size, in.Metadata
+	if in.StripMetadata && canSanitize(baseType(detected.String())) {
+		limit := config.LoadStripMaxSize()
+		content, err := io.ReadAll(io.LimitReader(reader, limit+1))
+		if err != nil {
+			return nil, uploadReadError(err)
+		}
+		if int64(len(content)) > limit {
+			return nil, fmt.Errorf("%w: images cleaned of metadata are limited to %d bytes", ErrFileTooLarge, limit)
+		}
+		content, exif, err := sanitizeImage(content, baseType(detected.String()))
+		if err != nil {
+			return nil, err
+		}
+		metadata = exifMetadata(exif, in.ExifFields)
+		for key, value := range in.Metadata {
+			metadata[key] = value
+		}
+		if err := checkMetadata(metadata); err != nil {
+			return nil, err
+		}
+		head = content[:min(len(content), headLen)]
+		reader, size = bytes.NewReader(content), int64(len(content))
+	}
+
+	if in.checkDimensions() && strings.HasPrefix(detected.String(), "image/") {
+		if err := checkImageDimensions(head, in); err != nil {
+			return nil, err
+		}
+	}
+
+	staged, err := stageBlob(ctx, in.Tenant, reader, size, detected.String())
+	if err != nil {
+		return nil, uploadReadError(err)
+	}
+	if staged.Size < in.MinSize {
+		staged.abort()
+		return nil, ErrFileTooSmall
+	}
+	media := extractMedia(ctx, staged, detected.String(), head)
+
+	// Save metadata in the database, using a unique file name without extension
+	return &pendingUpload{
+		staged:  staged,
+		presets: in.Presets,
+		record: models.File{
+			Tenant:           in.Tenant,
+			Filename:         uuid.New().String(),
+			OriginalName:     in.OriginalName,
+			MimeType:         detected.String(),
+			DeclaredMimeType: in.MimeType,
+			Folder:           CleanFolder(in.Folder),
+			Hash:             staged.Hash,
+			Size:             staged.Size,
+			Media:            media,
+			UploadedBy:       in.UploadedBy,
+			OwnerID:          in.UploadedBy,
+			Visibility:       visibility,
+			Version:          1,
+			Tags:             fileTags(tags),
+			Metadata:         fileMetadata(metadata),
+			CreatedAt:        time.Now(),
+			UpdatedAt:        time.Now(),
+		},
+	}, nil
+}
+
+// commit links the staged content to a blob and creates the File row inside
+// tx, in its folder which is created when missing
+func (p *pendingUpload) commit(ctx context.Context, tx *gorm.DB) error {
+	folder, err := ensureFolder(tx, p.record.Tenant, p.record.Folder, p.record.OwnerID)
+	if err != nil {
+		return err
+	}
+	p.record.FolderID = folderID(folder)
+
+	blob, err := commitBlob(ctx, tx, p.staged)
+	if err != nil {
+		return err
+	}
+	p.record.BlobID = &blob.ID
+	p.record.Disk = blob.Disk
+	p.record.Path = blob.Path
+	return tx.Create(&p.record).Error
+}
+
+// Store streams the content to the default disk and records it in the database.
+// Identical content is stored once and shared between File rows through a blob.
+func Store(ctx context.Context, in UploadInput) (*models.File, error) {
+	pending, err := prepare(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		return pending.commit(ctx, tx)
+	})
+	if err != nil {
+		pending.staged.abort()
+		return nil, err
+	}
+	pending.staged.finish()
+	applyPresets(ctx, &pending.record, pending.presets)
+
+	return &pending.record, nil
+}
+
+// Batch collects uploads that must be stored all together or not at all
+type Batch struct {
+	pending []*pendingUpload
+}
+
+// Stage streams one upload of the batch to the staging area. On error the
+// caller should Abort the batch to remove what was staged so far.
+func (b *Batch) Stage(ctx context.Context, in UploadInput) error {
+	pending, err := prepare(ctx, in)
+	if err != nil {
+		return err
+	}
+	b.pending = append(b.pending, pending)
+	return nil
+}
+
+// Commit records every staged upload in a single transaction. If any record
+// fails the transaction is rolled back and every staged object is removed.
+func (b *Batch) Commit(ctx context.Context) ([]*models.File, error) {
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		for _, pending := range b.pending {
+			if err := pending.commit(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Abort()
+		return nil, err
+	}
+
+	files := make([]*models.File, 0, len(b.pending))
+	for _, pending := range b.pending {
+		pending.staged.finish()
+		applyPresets(ctx, &pending.record, pending.presets)
+		files = append(files, &pending.record)
+	}
+	return files, nil
+}
+
+// Abort removes every object staged by the batch
+func (b *Batch) Abort() {
+	for _, pending := range b.pending {
+		pending.staged.abort()
+	}
+	b.pending = nil
+}
+
+// CleanFolder normalizes a folder path to "a/b" form without leading, trailing or parent segments
+func CleanFolder(folder string) string {
+	return strings.Trim(path.Clean("/"+strings.ReplaceAll(folder, "\\", "/")), "/")
+}
+
+// FileResponse prepares the response with detailed metadata for a stored file
+func FileResponse(file *models.File) map[string]interface{} {
+	tags, metadata := metadataResponse(file)
+	derivatives := make(map[string]string, len(file.Derivatives))
+	for _, derivative := range file.Derivatives {
+		derivatives[derivative.Preset] = derivative.Filename
+	}
+	response := map[string]interface{}{
+		"uri":          file.Filename,
+		"originalname": file.OriginalName,
+		"mimetype":     file.MimeType,
+		"size":         file.Size,
+		"folder":       file.Folder,
+		"folder_id":    file.FolderID,
+		"version":      file.Version,
+		"tags":         tags,
+		"metadata":     metadata,
+		"derivatives":  derivatives,
+		"created_at":   file.CreatedAt,
+	}
+	if file.Preset != "" {
+		response["preset"] = file.Preset
+	}
+	if file.UploadedBy != "" {
+		response["uploaded_by"] = file.UploadedBy
+	}
+	if file.OwnerID != "" {
+		response["owner_id"] = file.OwnerID
+	}
+	response["visibility"] = file.Visibility
+	mediaResponse(response, file.Media)
+	return response
+}
+
+// checkImageDimensions reads the image header and enforces the dimension bounds
+func checkImageDimensions(head []byte, in UploadInput) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return ErrImageUnreadable
+	}
+	if (in.MinWidth > 0 && cfg.Width < in.MinWidth) || (in.MaxWidth > 0 && cfg.Width > in.MaxWidth) ||
+		(in.MinHeight > 0 && cfg.Height < in.MinHeight) || (in.MaxHeight > 0 && cfg.Height > in.MaxHeight) {
+		return fmt.Errorf("%w: %dx%d", ErrImageDimensions, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// uploadReadError hides storage errors from clients while keeping size overflows recognizable
+func uploadReadError(err error) error {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return ErrRequestTooLarge
+	}
+	if errors.Is(err, ErrFileTooLarge) {
+		return ErrFileTooLarge
+	}
+	return errors.New("failed to save file")
+}
+
+// maxSizeReader fails with ErrFileTooLarge as soon as more than remaining bytes are read
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, ErrFileTooLarge
+	}
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"my-project/config"
+	"my-project/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrVersionNotFound is returned when a file has no such version
+var ErrVersionNotFound = errors.New("version not found")
+
+// lockFile loads a live file of tenant by filename inside tx, locking its row
+// so concurrent updates are applied one after the other
+func lockFile(tx *gorm.DB, tenant, filename string) (*models.File, error) {
+	var file models.File
+	err := withDetails(tx.Clauses(clause.Locking{Strength: "UPDATE"})).Where("tenant = ? AND filename = ?", tenant, filename).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// snapshotVersion moves the current content of file into its history. The
+// blob reference is handed over to the version row.
+func snapshotVersion(tx *gorm.DB, file *models.File) error {
+	return tx.Create(&models.FileVersion{
+		FileID:           file.ID,
+		Version:          file.Version,
+		OriginalName:     file.OriginalName,
+		MimeType:         file.MimeType,
+		DeclaredMimeType: file.DeclaredMimeType,
+		Disk:             file.Disk,
+		Path:             file.Path,
+		Size:             file.Size,
+		BlobID:           file.BlobID,
+		Hash:             file.Hash,
+		Media:            file.Media,
+		UploadedBy:       file.UploadedBy,
+		CreatedAt:        file.UpdatedAt,
+	}).Error
+}
+
+// replaceContent points file at new content as its next version
+func replaceContent(tx *gorm.DB, file *models.File, content models.FileVersion) error {
+	file.OriginalName = content.OriginalName
+	file.MimeType = content.MimeType
+	file.DeclaredMimeType = content.DeclaredMimeType
+	file.Disk = content.Disk
+	file.Path = content.Path
+	file.Size = content.Size
+	file.BlobID = content.BlobID
+	file.Hash = content.Hash
+	file.Media = content.Media
+	file.UploadedBy = content.UploadedBy
+	file.Version++
+	file.UpdatedAt = time.Now()
+	return tx.Select("original_name", "mime_type", "declared_mime_type", "disk", "path", "size",
+		"blob_id", "hash", "width", "height", "page_count", "duration", "codec", "blur_hash", "dominant_color", "uploaded_by", "version", "updated_at").Save(file).Error
+}
+
+// pruneVersions drops the oldest versions of a file beyond the retention
+// limit and returns the blobs that lost their last reference
+func pruneVersions(tx *gorm.DB, fileID uint, keep int) ([]*models.Blob, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	var expired []models.FileVersion
+	err := tx.Where("file_id = ?", fileID).Order("version DESC").Offset(keep).Find(&expired).Error
+	if err != nil {
+		return nil, err
+	}
+	return deleteVersions(tx, expired)
+}
+
+// deleteVersions removes version rows and releases their blobs
+func deleteVersions(tx *gorm.DB, versions []models.FileVersion) ([]*models.Blob, error) {
+	var orphans []*models.Blob
+	for _, version := range versions {
+		if err := tx.Delete(&models.FileVersion{}, version.ID).Error; err != nil {
+			return nil, err
+		}
+		if version.BlobID == nil {
+			continue
+		}
+		orphan, err := releaseBlob(tx, *version.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		if orphan != nil {
+			orphans = append(orphans, orphan)
+		}
+	}
+	return orphans, nil
+}
+
+// deleteBlobObjects removes the physical objects of unreferenced blobs
+func deleteBlobObjects(ctx context.Context, blobs []*models.Blob) error {
+	for _, blob := range blobs {
+		if err := deleteBlobObject(ctx, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateFile stores new content for an existing file of in.Tenant as its next
+// version. The previous content is kept in the version history, which is
+// trimmed to the configured number of versions.
+func UpdateFile(ctx context.Context, filename string, in UploadInput) (*models.File, error) {
+	pending, err := prepare(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *models.File
+	var orphans []*models.Blob
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		file, err = lockFile(tx, in.Tenant, filename)
+		if err != nil {
+			return err
+		}
+		blob, err := commitBlob(ctx, tx, pending.staged)
+		if err != nil {
+			return err
+		}
+		if err := snapshotVersion(tx, file); err != nil {
+			return err
+		}
+		err = replaceContent(tx, file, models.FileVersion{
+			OriginalName:     pending.record.OriginalName,
+			MimeType:         pending.record.MimeType,
+			DeclaredMimeType: pending.record.DeclaredMimeType,
+			Disk:             blob.Disk,
+			Path:             blob.Path,
+			Size:             pending.record.Size,
+			BlobID:           &blob.ID,
+			Hash:             blob.Hash,
+			Media:            pending.record.Media,
+			UploadedBy:       pending.record.UploadedBy,
+		})
+		if err != nil {
+			return err
+		}
+		orphans, err = pruneVersions(tx, file.ID, config.LoadVersionConfig().MaxVersions)
+		return err
+	})
+	if err != nil {
+		pending.staged.abort()
+		return nil, err
+	}
+	pending.staged.finish()
+
+	// Derivatives of the previous content are rendered again from the new one
+	applyPresets(ctx, file, derivativePresets(file))
+	return file, deleteBlobObjects(ctx, orphans)
+}
+
+// ListVersions returns a live file of tenant and its previous versions, newest first
+func ListVersions(tenant, filename string) (*models.File, []models.FileVersion, error) {
+	file, err := findFile(tenant, filename, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var versions []models.FileVersion
+	err = models.DB.Where("file_id = ?", file.ID).Order("version DESC").Find(&versions).Error
+	return file, versions, err
+}
+
+// findVersion loads a previous version of a file
+func findVersion(tx *gorm.DB, fileID uint, version int) (*models.FileVersion, error) {
+	var fileVersion models.FileVersion
+	err := tx.Where("file_id = ? AND version = ?", fileID, version).First(&fileVersion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileVersion, nil
+}
+
+// ReadFileVersion serves a specific version of a file of tenant, which may be the current one
+func ReadFileVersion(tenant, filename string, version int, download bool, c *gin.Context) error {
+	file, err := findFile(tenant, filename, false)
+	if err != nil {
+		return err
+	}
+
+	content := &models.FileVersion{
+		OriginalName: file.OriginalName,
+		MimeType:     file.MimeType,
+		Disk:         file.Disk,
+		Path:         file.Path,
+	}
+	if version != file.Version {
+		if content, err = findVersion(models.DB, file.ID, version); err != nil {
+			return err
+		}
+	}
+
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+	return serveObject(c, content.Disk, content.Path, content.MimeType, disposition+"; filename="+content.OriginalName)
+}
+
+// RollbackFile makes the content of a previous version current again. The
+// rollback is recorded as a new version so no history is lost.
+func RollbackFile(ctx context.Context, tenant, filename string, version int) (*models.File, error) {
+	var file *models.File
+	var orphans []*models.Blob
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		file, err = lockFile(tx, tenant, filename)
+		if err != nil {
+			return err
+		}
+		target, err := findVersion(tx, file.ID, version)
+		if err != nil {
+			return err
+		}
+
+		// The target keeps its own reference, the current content takes another one
+		if target.BlobID != nil {
+			var blob models.Blob
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, *target.BlobID).Error; err != nil {
+				return err
+			}
+			if err := incrementBlob(tx, &blob); err != nil {
+				return err
+			}
+		}
+		if err := snapshotVersion(tx, file); err != nil {
+			return err
+		}
+		if err := replaceContent(tx, file, *target); err != nil {
+			return err
+		}
+		orphans, err = pruneVersions(tx, file.ID, config.LoadVersionConfig().MaxVersions)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	applyPresets(ctx, file, derivativePresets(file))
+	return file, deleteBlobObjects(ctx, orphans)
+}
+
+// VersionResponse prepares the response describing a previous version of a file
+func VersionResponse(version *models.FileVersion) map[string]interface{} {
+	response := map[string]interface{}{
+		"version":      version.Version,
+		"originalname": version.OriginalName,
+		"mimetype":     version.MimeType,
+		"size":         version.Size,
+		"created_at":   version.CreatedAt,
+	}
+	mediaResponse(response, version.Media)
+	if version.UploadedBy != "" {
+		response["uploaded_by"] = version.UploadedBy
+	}
+	return response
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"my-project/config"
+	"my-project/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Visibilities of a file
+const (
+	VisibilityPrivate = "private" // read through the API with credentials or a signed URL
+	VisibilityPublic  = "public"  // also delivered without credentials by ServePublicFile
+)
+
+// ErrInvalidVisibility is returned for a visibility other than private or public
+var ErrInvalidVisibility = errors.New("visibility must be private or public")
+
+// fileVisibility validates a requested visibility, empty picking the configured default
+func fileVisibility(visibility string) (string, error) {
+	if visibility == "" {
+		visibility = config.LoadPublicConfig().DefaultVisibility
+	}
+	if visibility != VisibilityPrivate && visibility != VisibilityPublic {
+		return "", fmt.Errorf("%w: %q", ErrInvalidVisibility, visibility)
+	}
+	return visibility, nil
+}
+
+// SetVisibility makes a live file of tenant and its preset derivatives private or public
+func SetVisibility(tenant, filename, visibility string) (*models.File, error) {
+	if visibility != VisibilityPrivate && visibility != VisibilityPublic {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidVisibility, visibility)
+	}
+	file, err := findFile(tenant, filename, false)
+	if err != nil {
+		return nil, err
+	}
+	err = models.DB.Model(&models.File{}).Where("id = ? OR parent_id = ?", file.ID, file.ID).
+		UpdateColumn("visibility", visibility).Error
+	if err != nil {
+		return nil, err
+	}
+	file.Visibility = visibility
+	return file, nil
+}
+
+// ServePublicFile delivers a live public file, of any tenant since filenames
+// are unique, with caching headers. Private and unknown files are both
+// reported as ErrFileNotFound so their existence is not revealed.
+func ServePublicFile(filename string, download bool, c *gin.Context) error {
+	var file models.File
+	result := models.DB.Where("filename = ? AND visibility = ?", filename, VisibilityPublic).Limit(1).Find(&file)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFileNotFound
+	}
+
+	// The content of a filename changes with new versions, so caches
+	// revalidate against the hash once max-age has passed
+	etag := fileETag(&file)
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(config.LoadPublicConfig().MaxAge.Seconds())))
+	c.Header("ETag", etag)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if matchesETag(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return nil
+	}
+
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+	return serveObject(c, file.Disk, file.Path, file.MimeType, disposition+"; filename="+file.OriginalName)
+}
+
+// fileETag identifies the content of a file by its hash, or by its row and
+// last update for legacy files stored before hashes were recorded
+func fileETag(file *models.File) string {
+	if file.Hash == "" {
+		return `"` + strconv.FormatUint(uint64(file.ID), 10) + "-" + strconv.FormatInt(file.UpdatedAt.UnixNano(), 36) + `"`
+	}
+	return `"` + file.Hash + `"`
+}
+
+// matchesETag reports whether an If-None-Match header lists etag
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
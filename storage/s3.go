@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the buffer size used for multipart uploads of unknown length
+const s3PartSize = 8 * 1024 * 1024
+
+// S3Options configures an S3 compatible backend (AWS S3, MinIO, R2, ...)
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses objects as endpoint/bucket/key, which is what
+	// MinIO and most self-hosted stand-ins expect
+	PathStyle bool
+	Prefix    string
+}
+
+// S3 stores objects in a bucket using the S3 REST API signed with SigV4
+type S3 struct {
+	opts   S3Options
+	base   *url.URL
+	client *http.Client
+}
+
+// NewS3 creates an S3 compatible backend
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage requires an endpoint and a bucket")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	base, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	return &S3{opts: opts, base: base, client: &http.Client{Timeout: 0}}, nil
+}
+
+// objectURL builds the request URL for key, below the configured prefix
+func (s *S3) objectURL(key string, query url.Values) *url.URL {
+	return s.bucketURL(s.opts.Prefix+key, query)
+}
+
+// bucketURL builds the request URL for a raw path of the bucket using path or
+// virtual-host style
+func (s *S3) bucketURL(key string, query url.Values) *url.URL {
+	u := *s.base
+	key = strings.TrimPrefix(key, "/")
+	if s.opts.PathStyle {
+		u.Path = "/" + s.opts.Bucket + "/" + key
+	} else {
+		u.Host = s.opts.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	return &u
+}
+
+// do signs and sends a request, turning non 2xx responses into errors
+func (s *S3) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signV4(req, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, u.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// Put uploads r in a single request when the size is known and falls back to
+// a multipart upload otherwise, so streams never need to be buffered whole
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if size < 0 {
+		return s.putMultipart(ctx, key, r, header)
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key, nil), r, size, header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// putMultipart streams r to the bucket in s3PartSize chunks
+func (s *S3) putMultipart(ctx context.Context, key string, r io.Reader, header http.Header) error {
+	resp, err := s.do(ctx, http.MethodPost, s.objectURL(key, url.Values{"uploads": {""}}), nil, 0, header)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []part
+	abort := func(cause error) error {
+		if resp, err := s.do(context.Background(), http.MethodDelete, s.objectURL(key, url.Values{"uploadId": {initiated.UploadID}}), nil, 0, nil); err == nil {
+			resp.Body.Close()
+		}
+		return cause
+	}
+
+	buf := make([]byte, s3PartSize)
+	for number := 1; ; number++ {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 || number == 1 {
+			q := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadID}}
+			resp, err := s.do(ctx, http.MethodPut, s.objectURL(key, q), bytes.NewReader(buf[:n]), int64(n), nil)
+			if err != nil {
+				return abort(err)
+			}
+			resp.Body.Close()
+			parts = append(parts, part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return abort(readErr)
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return abort(err)
+	}
+	resp, err = s.do(ctx, http.MethodPost, s.objectURL(key, url.Values{"uploadId": {initiated.UploadID}}), bytes.NewReader(body), int64(len(body)), nil)
+	if err != nil {
+		return abort(err)
+	}
+	return resp.Body.Close()
+}
+
+// Get streams the object body
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key, nil), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat issues a HEAD request for the object
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(key, nil), nil, 0, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ObjectInfo{
+		Key:          key,
+		Size:         resp.ContentLength,
+		ContentType:  resp.Header.Get("Content-Type"),
+		LastModified: modified,
+	}, nil
+}
+
+// Delete removes the object; S3 already treats missing keys as success
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key, nil), nil, 0, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Move copies the object server side and deletes the source
+func (s *S3) Move(ctx context.Context, src, dst string) error {
+	source := "/" + s.opts.Bucket + "/" + strings.TrimPrefix(s.opts.Prefix+src, "/")
+	header := http.Header{"X-Amz-Copy-Source": {(&url.URL{Path: source}).EscapedPath()}}
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(dst, nil), nil, 0, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return s.Delete(ctx, src)
+}
+
+// List pages through ListObjectsV2 for every key under prefix
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {s.opts.Prefix + prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		// The prefix only belongs in the query, the request targets the bucket
+		u := s.bucketURL("", q)
+		resp, err := s.do(ctx, http.MethodGet, u, nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          strings.TrimPrefix(c.Key, s.opts.Prefix),
+				Size:         c.Size,
+				LastModified: c.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist in the storage backend
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes an object stored in a backend
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage is implemented by every backend that can hold uploaded files.
+// Keys are slash separated paths relative to the backend root.
+type Storage interface {
+	// Put stores the content of r under key. size may be -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key. The returned reader also
+	// implements io.Seeker when the backend supports random access.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat returns the object metadata or ErrNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Move renames an object within the backend, replacing dst if it exists
+	Move(ctx context.Context, src, dst string) error
+}
+
+var (
+	mu          sync.RWMutex
+	disks       = map[string]Storage{}
+	defaultDisk string
+)
+
+// Register makes a backend available under the given disk name
+func Register(name string, s Storage) {
+	mu.Lock()
+	defer mu.Unlock()
+	disks[name] = s
+}
+
+// SetDefault selects the disk used for new uploads
+func SetDefault(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultDisk = name
+}
+
+// DefaultName returns the name of the disk used for new uploads
+func DefaultName() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultDisk
+}
+
+// Disk returns the backend registered under name. An empty name resolves
+// to the default disk so records created before disks existed keep working.
+func Disk(name string) (Storage, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if name == "" {
+		name = defaultDisk
+	}
+	s, ok := disks[name]
+	if !ok {
+		return nil, fmt.Errorf("storage disk %q is not configured", name)
+	}
+	return s, nil
+}
+
+// Default returns the backend used for new uploads
+func Default() (Storage, error) {
+	return Disk("")
+}